@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/rxxuzi/tune/internal/config"
 	"github.com/rxxuzi/tune/internal/server"
 )
 
@@ -15,9 +16,27 @@ func main() {
 		port = "9000"
 	}
 
+	// 設定の読み込み
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Fatal("Failed to load config: %v", err)
+	}
+
 	// ハンドラ登録
 	mux := http.NewServeMux()
-	server.RegisterHandlers(mux)
+	if err := server.RegisterHandlers(mux, cfg); err != nil {
+		logger.Fatal("Invalid config: %v", err)
+	}
+
+	// プロキシ先のアプリを別オリジンで配信する
+	if cfg.Proxy.Listen != "" {
+		go func() {
+			logger.Info("Serving proxied apps on %s", cfg.Proxy.Listen)
+			if err := http.ListenAndServe(cfg.Proxy.Listen, server.ProxyHandler(port)); err != nil {
+				logger.Fatal("Proxy listener failure: %v", err)
+			}
+		}()
+	}
 
 	// サーバー起動
 	addr := ":" + port
@@ -5,15 +5,15 @@ go 1.23
 toolchain go1.23.4
 
 require (
+	github.com/google/uuid v1.6.0
 	github.com/gorilla/sessions v1.4.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/pkg/sftp v1.13.7
 	golang.org/x/crypto v0.30.0
+	golang.org/x/sys v0.28.0
 )
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/kr/fs v0.1.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 )
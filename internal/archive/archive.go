@@ -0,0 +1,191 @@
+// Package archive writes ZIP and tar.gz archives entry by entry so that
+// they can be streamed to the browser while the files are read.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Supported formats
+const (
+	Zip   = "zip"
+	TarGz = "tar.gz"
+)
+
+// Entry types
+const (
+	File    = "file"
+	Dir     = "dir"
+	Symlink = "symlink"
+)
+
+// Entry describes one file in the archive
+type Entry struct {
+	// Name is the slash separated path inside the archive
+	Name    string
+	Type    string
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	// Link is the target of a symlink
+	Link string
+}
+
+// Writer adds entries to an archive. For files, Add copies exactly
+// e.Size bytes from r; other entry types ignore r.
+type Writer interface {
+	Add(e Entry, r io.Reader) error
+	Close() error
+}
+
+// New returns a Writer for format writing to w
+func New(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case Zip:
+		return &zipWriter{zw: zip.NewWriter(w)}, nil
+	case TarGz:
+		gz := gzip.NewWriter(w)
+		return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format: %q", format)
+}
+
+// ContentType returns the MIME type of format
+func ContentType(format string) string {
+	if format == TarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Excluded reports whether name, a path inside the archive, matches one
+// of the patterns. Patterns without a slash match any path component
+// (like "node_modules" or "*.log"); patterns with a slash match the path
+// from the archive root. A match on a directory excludes its contents.
+func Excluded(patterns []string, name string) bool {
+	parts := strings.Split(name, "/")
+	for _, p := range patterns {
+		p = strings.TrimSuffix(strings.TrimPrefix(p, "/"), "/")
+		if p == "" {
+			continue
+		}
+		if strings.Contains(p, "/") {
+			n := strings.Count(p, "/") + 1
+			for i := n; i <= len(parts); i++ {
+				if ok, _ := path.Match(p, strings.Join(parts[:i], "/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, part := range parts {
+			if ok, _ := path.Match(p, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) Add(e Entry, r io.Reader) error {
+	h := &zip.FileHeader{
+		Name:     e.Name,
+		Method:   zip.Deflate,
+		Modified: e.ModTime,
+	}
+	switch e.Type {
+	case Dir:
+		h.Name += "/"
+		h.Method = zip.Store
+		h.SetMode(fs.ModeDir | e.Mode)
+	case Symlink:
+		h.SetMode(fs.ModeSymlink | 0777)
+	default:
+		h.SetMode(e.Mode)
+	}
+	w, err := z.zw.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	switch e.Type {
+	case Symlink:
+		_, err = io.WriteString(w, e.Link)
+	case File:
+		err = copyExact(w, r, e.Size)
+	}
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarWriter) Add(e Entry, r io.Reader) error {
+	h := &tar.Header{
+		Name:    e.Name,
+		Mode:    int64(e.Mode.Perm()),
+		ModTime: e.ModTime,
+	}
+	switch e.Type {
+	case Dir:
+		h.Typeflag = tar.TypeDir
+		h.Name += "/"
+	case Symlink:
+		h.Typeflag = tar.TypeSymlink
+		h.Linkname = e.Link
+	default:
+		h.Typeflag = tar.TypeReg
+		h.Size = e.Size
+	}
+	if err := t.tw.WriteHeader(h); err != nil {
+		return err
+	}
+	if e.Type == File {
+		return copyExact(t.tw, r, e.Size)
+	}
+	return nil
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// copyExact copies size bytes from r. If the file shrank while it was
+// read, the rest is filled with zeros so that the archive stays valid.
+func copyExact(w io.Writer, r io.Reader, size int64) error {
+	n, err := io.Copy(w, io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	if n < size {
+		_, err = io.CopyN(w, zeros{}, size-n)
+	}
+	return err
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
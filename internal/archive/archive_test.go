@@ -0,0 +1,31 @@
+package archive
+
+import "testing"
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "src/main.go", false},
+		{[]string{"node_modules"}, "app/node_modules/x/index.js", true},
+		{[]string{"node_modules"}, "app/node_modules", true},
+		{[]string{"node_modules"}, "app/node_modules_old/a", false},
+		{[]string{"*.log"}, "logs/app.log", true},
+		{[]string{"*.log"}, "logs/app.log.gz", false},
+		{[]string{".git"}, "repo/.git/HEAD", true},
+		{[]string{"app/build"}, "app/build/out.o", true},
+		{[]string{"app/build"}, "app/src/build/out.o", false},
+		{[]string{"/app/build/"}, "app/build", true},
+		{[]string{"app/*/tmp"}, "app/x/tmp/a", true},
+		{[]string{"", "/"}, "anything", false},
+		{[]string{"[invalid"}, "a/[invalid", false},
+		{[]string{"a", "b"}, "x/b/y", true},
+	}
+	for _, tt := range tests {
+		if got := Excluded(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("Excluded(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,26 +1,162 @@
 package command
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/rxxuzi/tune/internal/logger"
 	"golang.org/x/crypto/ssh"
 )
 
-func ExecuteCommand(client *ssh.Client, cmd string) (string, error) {
+// Result holds the outcome of a remote command
+type Result struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Truncated is set when output beyond the limit was discarded
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// limitedBuffer keeps at most limit bytes and discards the rest, so that
+// commands with huge output cannot exhaust memory. A limit of 0 or less
+// keeps everything.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 {
+		if room := b.limit - b.buf.Len(); len(p) > room {
+			b.buf.Write(p[:max(room, 0)])
+			b.truncated = true
+			// 読み続けないとリモートのコマンドが止まるので、捨てた分も書き込めたことにする
+			return len(p), nil
+		}
+	}
+	return b.buf.Write(p)
+}
+
+// String returns the kept output, marked if anything was discarded
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[truncated]"
+	}
+	return b.buf.String()
+}
+
+// Join quotes each argument and joins them into a single command line
+func Join(argv ...string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = Quote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Run executes argv on the remote host. Every argument is quoted, so
+// nothing is expanded by the remote shell. A non-zero exit status is
+// reported in Result.ExitCode rather than as an error.
+func Run(ctx context.Context, client *ssh.Client, argv ...string) (*Result, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return RunShell(ctx, client, Join(argv...))
+}
+
+// RunInput is like Run but feeds stdin to the command
+func RunInput(ctx context.Context, client *ssh.Client, stdin io.Reader, argv ...string) (*Result, error) {
+	if len(argv) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return run(ctx, client, Join(argv...), stdin, 0)
+}
+
+// RunShell executes a command line through the remote user's shell.
+// Only use it for commands typed by the user; build everything else with Run.
+func RunShell(ctx context.Context, client *ssh.Client, cmd string) (*Result, error) {
+	return run(ctx, client, cmd, nil, 0)
+}
+
+// RunShellLimit is like RunShell but keeps at most limit bytes of stdout
+// and of stderr each. Output beyond that is read and discarded.
+func RunShellLimit(ctx context.Context, client *ssh.Client, cmd string, limit int) (*Result, error) {
+	return run(ctx, client, cmd, nil, limit)
+}
+
+func run(ctx context.Context, client *ssh.Client, cmd string, stdin io.Reader, limit int) (*Result, error) {
 	session, err := client.NewSession()
 	if err != nil {
 		logger.Err("Failed to create SSH session: %v", err)
-		return "", err
+		return nil, err
 	}
 	defer session.Close()
 
-	output, err := session.CombinedOutput(cmd)
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if err := session.Start(cmd); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// タイムアウトまたはキャンセル
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		logger.Warn("Command '%s' cancelled: %v", cmd, ctx.Err())
+		return nil, ctx.Err()
+	case err = <-done:
+	}
+
+	result := &Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
 	if err != nil {
-		logger.Err("Failed to execute command '%s'. Output: %s, Error: %v", cmd, string(output), err)
-		return "", fmt.Errorf("command failed: %v, output: %s", err, string(output))
+		code, ok := ExitCode(err)
+		if !ok {
+			logger.Err("Failed to execute command '%s': %v", cmd, err)
+			return nil, err
+		}
+		result.ExitCode = code
 	}
+	return result, nil
+}
 
-	return strings.TrimSpace(string(output)), nil
+// Output runs argv and returns its trimmed stdout.
+// A non-zero exit status is returned as an error including stderr.
+func Output(ctx context.Context, client *ssh.Client, argv ...string) (string, error) {
+	result, err := Run(ctx, client, argv...)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		logger.Err("Command '%s' exited with %d: %s", Join(argv...), result.ExitCode, strings.TrimSpace(result.Stderr))
+		return "", fmt.Errorf("command failed: exit status %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// ExitCode extracts the exit status from an error returned by ssh.Session.Wait
+func ExitCode(err error) (int, bool) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
 }
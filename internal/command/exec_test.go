@@ -0,0 +1,29 @@
+package command
+
+import "testing"
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		limit  int
+		writes []string
+		want   string
+	}{
+		{0, []string{"abc", "def"}, "abcdef"},
+		{6, []string{"abc", "def"}, "abcdef"},
+		{4, []string{"abc", "def"}, "abcd\n[truncated]"},
+		{2, []string{"abc", "def"}, "ab\n[truncated]"},
+		{3, []string{"abc", "", "d"}, "abc\n[truncated]"},
+	}
+	for _, tt := range tests {
+		b := &limitedBuffer{limit: tt.limit}
+		for _, w := range tt.writes {
+			// 捨てた分も含めて書き込めたことにしないとセッションが止まる
+			if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+				t.Errorf("limit %d: Write(%q) = %d, %v", tt.limit, w, n, err)
+			}
+		}
+		if got := b.String(); got != tt.want {
+			t.Errorf("limit %d: got %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package command
+
+import "strings"
+
+// Quote returns s quoted for a POSIX shell
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	// zsh は先頭の = をコマンドのパスに展開する (=ls → /bin/ls)
+	if !strings.HasPrefix(s, "=") && strings.IndexFunc(s, needsQuote) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// needsQuote reports whether r is not safe to appear unquoted in a shell word
+func needsQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("-_./:@%+=,", r):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+var quoteTests = []struct {
+	in, want string
+}{
+	{"", "''"},
+	{"plain", "plain"},
+	{"/home/u/file-1.txt", "/home/u/file-1.txt"},
+	{"user@host:22", "user@host:22"},
+	{"a b", "'a b'"},
+	{"it's", `'it'\''s'`},
+	{"$HOME", "'$HOME'"},
+	{"`id`", "'`id`'"},
+	{"a;rm -rf /", "'a;rm -rf /'"},
+	{"line\nbreak", "'line\nbreak'"},
+	{"*.go", "'*.go'"},
+	{"key=value", "key=value"},
+	{"=ls", "'=ls'"},
+	{"日本語", "'日本語'"},
+}
+
+func TestQuote(t *testing.T) {
+	for _, tt := range quoteTests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	got := Join("grep", "-e", "a b", "--", "it's")
+	want := `grep -e 'a b' -- 'it'\''s'`
+	if got != want {
+		t.Errorf("Join = %q, want %q", got, want)
+	}
+}
+
+// シェルに通したときに元の引数がそのまま得られることを確かめる
+func TestQuoteShellRoundTrip(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	var args []string
+	for _, tt := range quoteTests {
+		args = append(args, tt.in)
+	}
+	out, err := exec.Command(sh, "-c", Join(append([]string{"printf", `%s\0`}, args...)...)).Output()
+	if err != nil {
+		t.Fatalf("sh: %v", err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(got) != len(args) {
+		t.Fatalf("got %d arguments, want %d: %q", len(got), len(args), got)
+	}
+	for i := range args {
+		if got[i] != args[i] {
+			t.Errorf("argument %d = %q, want %q", i, got[i], args[i])
+		}
+	}
+}
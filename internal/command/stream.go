@@ -0,0 +1,144 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// Output stream names passed to LineFunc
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// LineFunc receives a line of output without its trailing newline.
+// Calls are serialized, never concurrent.
+type LineFunc func(stream, line string)
+
+// Process is a remote command whose output is delivered line by line
+type Process struct {
+	session *ssh.Session
+	onLine  LineFunc
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// maxLineSize is the longest line delivered; longer lines are split
+const maxLineSize = 1 << 20
+
+// StartShell starts a command line through the remote user's shell and
+// calls onLine for every line of stdout and stderr as it arrives.
+func StartShell(client *ssh.Client, cmd string, onLine LineFunc) (*Process, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		logger.Err("Failed to create SSH session: %v", err)
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	p := &Process{session: session, onLine: onLine}
+	p.wg.Add(2)
+	go p.scan(Stdout, stdout)
+	go p.scan(Stderr, stderr)
+	return p, nil
+}
+
+// Start starts argv with every argument quoted, see StartShell
+func Start(client *ssh.Client, argv []string, onLine LineFunc) (*Process, error) {
+	return StartShell(client, Join(argv...), onLine)
+}
+
+func (p *Process) scan(stream string, r io.Reader) {
+	defer p.wg.Done()
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if len(line) > 0 {
+				p.emit(stream, line)
+			}
+			if err != io.EOF {
+				logger.Debug("Stream %s closed: %v", stream, err)
+			}
+			return
+		}
+		line = append(line, chunk...)
+		if isPrefix && len(line) < maxLineSize {
+			continue
+		}
+		p.emit(stream, line)
+		line = line[:0]
+	}
+}
+
+func (p *Process) emit(stream string, line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onLine(stream, string(line))
+}
+
+// Signal sends a signal to the remote process
+func (p *Process) Signal(sig ssh.Signal) error {
+	return p.session.Signal(sig)
+}
+
+// Close closes the session, which ends the output streams
+func (p *Process) Close() error {
+	return p.session.Close()
+}
+
+// Wait waits until all output has been delivered and the command has exited.
+// It returns the exit code, or -1 and an error if no exit status was received.
+func (p *Process) Wait() (int, error) {
+	p.wg.Wait()
+	err := p.session.Wait()
+	p.session.Close()
+	if err == nil {
+		return 0, nil
+	}
+	if code, ok := ExitCode(err); ok {
+		return code, nil
+	}
+	return -1, err
+}
+
+// Stream runs a command line through the remote shell, calling onLine for
+// every line of output, and returns its exit code. The command is killed
+// when ctx is done.
+func Stream(ctx context.Context, client *ssh.Client, cmd string, onLine LineFunc) (int, error) {
+	p, err := StartShell(client, cmd, onLine)
+	if err != nil {
+		return -1, err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		p.Signal(ssh.SIGKILL)
+		p.Close()
+	})
+	defer stop()
+
+	code, err := p.Wait()
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	return code, err
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// Config holds the settings read from ~/.tune/config.json
+type Config struct {
+	Login LoginConfig `json:"login"`
+	Hosts HostPolicy  `json:"hosts"`
+	// AllowedOrigins lists extra origins (https://example.com) permitted
+	// to open WebSockets. The origin serving tune is always allowed.
+	AllowedOrigins []string `json:"allowed_origins"`
+	// Profiles holds per-host settings keyed by host name
+	Profiles map[string]HostConfig `json:"profiles"`
+	FanOut   FanOutConfig          `json:"fanout"`
+	Forward  ForwardConfig         `json:"forward"`
+	Proxy    ProxyConfig           `json:"proxy"`
+	Drive    DriveConfig           `json:"drive"`
+}
+
+// ProxyConfig controls how web apps on the remote host are proxied
+type ProxyConfig struct {
+	// Listen is an extra address (":9001") that serves only the proxied
+	// apps, so that they run on a different origin from tune. When empty
+	// they are served under /proxy/ on tune's own origin.
+	Listen string `json:"listen"`
+	// Origin is the URL browsers use to reach Listen, such as
+	// https://apps.example.com behind a reverse proxy. The default is
+	// tune's host name with the port of Listen.
+	Origin string `json:"origin"`
+}
+
+// DriveConfig limits the files handled by the drive
+type DriveConfig struct {
+	// MaxEditSize is the largest file in bytes opened in the editor
+	MaxEditSize int64 `json:"max_edit_size"`
+	// MaxPreviewSize is the largest file previewed in one response;
+	// range requests for media are answered in chunks of this size
+	MaxPreviewSize int64 `json:"max_preview_size"`
+	// TrashMaxAge is how long deleted items stay in the trash before they
+	// are purged automatically; 0 keeps them until purged by hand
+	TrashMaxAge Duration `json:"trash_max_age"`
+	// ThumbCacheMaxAge removes thumbnails not used for this long
+	ThumbCacheMaxAge Duration `json:"thumb_cache_max_age"`
+	// ThumbCacheMaxSize caps the thumbnail cache in bytes; the least
+	// recently used thumbnails are removed first
+	ThumbCacheMaxSize int64 `json:"thumb_cache_max_size"`
+}
+
+// ForwardConfig controls the port forwards tune opens on its own machine
+type ForwardConfig struct {
+	// AllowPublicBind permits local and dynamic forwards to listen on
+	// addresses other than loopback
+	AllowPublicBind bool `json:"allow_public_bind"`
+}
+
+// FanOutConfig controls running a command on many saved hosts at once
+type FanOutConfig struct {
+	// Concurrency is the number of hosts connected in parallel
+	Concurrency int `json:"concurrency"`
+	// Timeout bounds connecting and running the command on each host
+	Timeout Duration `json:"timeout"`
+}
+
+// HostConfig holds the settings of a single host
+type HostConfig struct {
+	// Root confines the drive and uploader to a directory on the host:
+	// "~" for the home directory (default), "~/project", "/srv/www" or "/"
+	Root string `json:"root"`
+	// Sudo runs privileged operations (such as systemctl start) through
+	// "sudo -n"; the user needs passwordless sudo for them
+	Sudo bool `json:"sudo"`
+}
+
+// LoginConfig controls brute-force protection on the login endpoints
+type LoginConfig struct {
+	// AttemptsPerMinute limits login attempts per client IP and per target
+	AttemptsPerMinute int `json:"attempts_per_minute"`
+	// MaxFailures is the number of consecutive failures before a lockout
+	MaxFailures int `json:"max_failures"`
+	// BaseDelay is the first backoff delay; it doubles after every failure
+	BaseDelay Duration `json:"base_delay"`
+	// MaxDelay caps the exponential backoff
+	MaxDelay Duration `json:"max_delay"`
+	// Lockout is how long a key stays locked after MaxFailures
+	Lockout Duration `json:"lockout"`
+	// ResetAfter forgets failures after this much quiet time
+	ResetAfter Duration `json:"reset_after"`
+	// TrustProxyHeaders uses the address added to X-Forwarded-For by the
+	// reverse proxy in front of tune as the client IP
+	TrustProxyHeaders bool `json:"trust_proxy_headers"`
+}
+
+// HostPolicy restricts the hosts tune is permitted to connect to.
+// Entries are hostnames, wildcard hostnames (*.example.com), IPs or CIDRs.
+type HostPolicy struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Duration is a time.Duration that is written as "30s" or "5m" in JSON
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var sec float64
+	if err := json.Unmarshal(data, &sec); err != nil {
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	*d = Duration(sec * float64(time.Second))
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Std returns the value as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// Profile returns the settings for host, or the defaults if none are configured
+func (c *Config) Profile(host string) HostConfig {
+	if p, ok := c.Profiles[host]; ok {
+		return p
+	}
+	return HostConfig{}
+}
+
+// Default returns the configuration used when no config file exists
+func Default() *Config {
+	return &Config{
+		Login: LoginConfig{
+			AttemptsPerMinute: 10,
+			MaxFailures:       5,
+			BaseDelay:         Duration(time.Second),
+			MaxDelay:          Duration(30 * time.Second),
+			Lockout:           Duration(15 * time.Minute),
+			ResetAfter:        Duration(time.Hour),
+		},
+		FanOut: FanOutConfig{
+			Concurrency: 5,
+			Timeout:     Duration(2 * time.Minute),
+		},
+		Drive: DriveConfig{
+			MaxEditSize:       2 << 20,
+			MaxPreviewSize:    64 << 20,
+			TrashMaxAge:       Duration(30 * 24 * time.Hour),
+			ThumbCacheMaxAge:  Duration(30 * 24 * time.Hour),
+			ThumbCacheMaxSize: 256 << 20,
+		},
+	}
+}
+
+// Dir returns the tune directory (~/.tune)
+func Dir() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(u.HomeDir, ".tune"), nil
+}
+
+// Path returns the config file path. TUNE_CONFIG overrides the default.
+func Path() (string, error) {
+	if p := os.Getenv("TUNE_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// Load reads the config file on top of the defaults.
+// A missing file is not an error.
+func Load() (*Config, error) {
+	cfg := Default()
+	p, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,133 @@
+// Package container builds docker/podman CLI commands and parses their output.
+package container
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DetectScript prints the path of the container CLI installed on the host
+const DetectScript = "command -v docker || command -v podman"
+
+// Container is a container listed by "ps -a"
+type Container struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	State   string `json:"state"`
+	Status  string `json:"status"`
+	Ports   string `json:"ports"`
+	Created string `json:"created"`
+}
+
+// Image is a local image
+type Image struct {
+	ID         string `json:"id"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Size       string `json:"size"`
+	Created    string `json:"created"`
+}
+
+// Actions lists the operations permitted on a container
+var Actions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+}
+
+// docker と podman の両方で使えるフィールドのみを使う
+const (
+	psFormat     = "{{.ID}}\t{{.Names}}\t{{.Image}}\t{{.State}}\t{{.Status}}\t{{.Ports}}\t{{.CreatedAt}}"
+	imagesFormat = "{{.ID}}\t{{.Repository}}\t{{.Tag}}\t{{.Size}}\t{{.CreatedSince}}"
+)
+
+// execShell starts bash if the image has it, sh otherwise
+const execShell = "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidID reports whether id is a plausible container ID or name
+func ValidID(id string) bool {
+	return len(id) <= 128 && idPattern.MatchString(id)
+}
+
+// Runtime returns "docker" or "podman" from the output of DetectScript
+func Runtime(out string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	switch name := path.Base(line); name {
+	case "docker", "podman":
+		return name
+	}
+	return ""
+}
+
+// PSArgs lists all containers
+func PSArgs(runtime string) []string {
+	return []string{runtime, "ps", "-a", "--no-trunc", "--format", psFormat}
+}
+
+// ImagesArgs lists local images
+func ImagesArgs(runtime string) []string {
+	return []string{runtime, "images", "--format", imagesFormat}
+}
+
+// ActionArgs runs a lifecycle action on a container
+func ActionArgs(runtime, action, id string) []string {
+	return []string{runtime, action, "--", id}
+}
+
+// LogsArgs follows the logs of a container
+func LogsArgs(runtime, id, tail string) []string {
+	return []string{runtime, "logs", "-f", "-t", "--tail", tail, "--", id}
+}
+
+// ExecArgs opens an interactive shell in a container
+func ExecArgs(runtime, id string) []string {
+	return []string{runtime, "exec", "-it", id, "sh", "-c", execShell}
+}
+
+// ParseContainers parses the output of PSArgs
+func ParseContainers(out string) []Container {
+	list := []Container{}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) < 7 {
+			continue
+		}
+		id := f[0]
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		list = append(list, Container{
+			ID:      id,
+			Name:    f[1],
+			Image:   f[2],
+			State:   strings.ToLower(f[3]),
+			Status:  f[4],
+			Ports:   f[5],
+			Created: f[6],
+		})
+	}
+	return list
+}
+
+// ParseImages parses the output of ImagesArgs
+func ParseImages(out string) []Image {
+	list := []Image{}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) < 5 {
+			continue
+		}
+		list = append(list, Image{
+			ID:         strings.TrimPrefix(f[0], "sha256:"),
+			Repository: f[1],
+			Tag:        f[2],
+			Size:       f[3],
+			Created:    f[4],
+		})
+	}
+	return list
+}
@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-01-01 は月曜日
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr string
+		from string
+		want string // 空なら該当なし
+	}{
+		{"* * * * *", "2024-01-01 10:00:30", "2024-01-01 10:01:00"},
+		{"*/15 * * * *", "2024-01-01 10:07:00", "2024-01-01 10:15:00"},
+		{"5/15 * * * *", "2024-01-01 10:21:00", "2024-01-01 10:35:00"},
+		{"0 9 * * 1-5", "2024-01-06 12:00:00", "2024-01-08 09:00:00"},
+		{"@daily", "2024-01-01 00:00:00", "2024-01-02 00:00:00"},
+		{"@yearly", "2024-03-01 00:00:00", "2025-01-01 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 31 4 *", "2024-01-01 00:00:00", ""},
+		{"0 12 * * 7", "2024-01-01 00:00:00", "2024-01-07 12:00:00"},
+		{"30 6 * jan,feb mon", "2024-02-27 00:00:00", "2025-01-06 06:30:00"},
+		{"0 0 15 * *", "2024-01-01 00:00:00", "2024-01-15 00:00:00"},
+		// 日と曜日の両方を指定すると、どちらかに一致すればよい
+		{"0 0 13 * 5", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		{"0 0 13 * 5", "2024-01-12 00:00:00", "2024-01-13 00:00:00"},
+		// * で始まるステップは無指定と同じ扱いで、両方に一致する必要がある
+		{"0 0 */2 * 1", "2024-01-01 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 1-31/2 * 1", "2024-01-01 00:00:00", "2024-01-03 00:00:00"},
+		{"0 0 1 * */2", "2024-01-01 00:00:00", "2024-02-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		got := s.Next(at(tt.from))
+		var want time.Time
+		if tt.want != "" {
+			want = at(tt.want)
+		}
+		if !got.Equal(want) {
+			t.Errorf("Parse(%q).Next(%s) = %s, want %s", tt.expr, tt.from, got, want)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package logger
+
+// initializeColors is a no-op; other terminals understand ANSI codes
+func initializeColors() {}
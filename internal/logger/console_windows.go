@@ -0,0 +1,17 @@
+//go:build windows
+
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// initializeColors initializes ANSI color support on Windows
+func initializeColors() {
+	stdout := windows.Handle(os.Stdout.Fd())
+	var originalMode uint32
+	windows.GetConsoleMode(stdout, &originalMode)
+	windows.SetConsoleMode(stdout, originalMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+}
@@ -4,10 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"runtime"
 	"time"
-
-	"golang.org/x/sys/windows"
 )
 
 // LogLevel defines the level of logging
@@ -38,16 +35,6 @@ const (
 	White  = "\033[37m"
 )
 
-// initializeColors initializes ANSI color support on Windows
-func initializeColors() {
-	if runtime.GOOS == "windows" {
-		stdout := windows.Handle(os.Stdout.Fd())
-		var originalMode uint32
-		windows.GetConsoleMode(stdout, &originalMode)
-		windows.SetConsoleMode(stdout, originalMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
-	}
-}
-
 // SetLevel sets the global log level
 func SetLevel(l LogLevel) {
 	level = l
@@ -0,0 +1,204 @@
+// Package monitor parses Linux system metrics read from /proc and df.
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Script prints every source used by Parse, separated by marker lines.
+// It is run on the remote host through a POSIX shell.
+const Script = `echo '##loadavg'; cat /proc/loadavg; ` +
+	`echo '##meminfo'; cat /proc/meminfo; ` +
+	`echo '##stat'; grep '^cpu ' /proc/stat; ` +
+	`echo '##netdev'; cat /proc/net/dev; ` +
+	`echo '##df'; df -P -k 2>/dev/null; true`
+
+// Snapshot holds the raw counters read at a point in time
+type Snapshot struct {
+	Time      time.Time
+	Load      [3]float64
+	MemTotal  uint64
+	MemAvail  uint64
+	SwapTotal uint64
+	SwapFree  uint64
+	CPUBusy   uint64
+	CPUTotal  uint64
+	NetRx     uint64
+	NetTx     uint64
+	Disks     []Disk
+}
+
+// Disk is the usage of a mounted filesystem in bytes
+type Disk struct {
+	Mount string `json:"mount"`
+	Total uint64 `json:"total"`
+	Used  uint64 `json:"used"`
+}
+
+// Sample is a point of the time series sent to the dashboard
+type Sample struct {
+	Time      time.Time  `json:"time"`
+	Load      [3]float64 `json:"load"`
+	CPU       float64    `json:"cpu"` // 使用率 (%)
+	MemTotal  uint64     `json:"mem_total"`
+	MemUsed   uint64     `json:"mem_used"`
+	SwapTotal uint64     `json:"swap_total"`
+	SwapUsed  uint64     `json:"swap_used"`
+	NetRx     float64    `json:"net_rx"` // bytes/s
+	NetTx     float64    `json:"net_tx"` // bytes/s
+	Disks     []Disk     `json:"disks"`
+}
+
+// 集計対象外の仮想ファイルシステム
+var skipFilesystems = map[string]bool{
+	"tmpfs":    true,
+	"devtmpfs": true,
+	"overlay":  true,
+	"udev":     true,
+	"none":     true,
+	"shm":      true,
+}
+
+// Parse reads the output of Script
+func Parse(out string, t time.Time) (*Snapshot, error) {
+	s := &Snapshot{Time: t}
+	section := ""
+	seen := map[string]bool{}
+
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "##") {
+			section = line[2:]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch section {
+		case "loadavg":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("malformed /proc/loadavg: %q", line)
+			}
+			for i := 0; i < 3; i++ {
+				s.Load[i], _ = strconv.ParseFloat(fields[i], 64)
+			}
+			seen[section] = true
+		case "meminfo":
+			if len(fields) < 2 {
+				continue
+			}
+			// 値は kB 単位
+			v, _ := strconv.ParseUint(fields[1], 10, 64)
+			switch fields[0] {
+			case "MemTotal:":
+				s.MemTotal = v * 1024
+			case "MemAvailable:":
+				s.MemAvail = v * 1024
+			case "SwapTotal:":
+				s.SwapTotal = v * 1024
+			case "SwapFree:":
+				s.SwapFree = v * 1024
+			}
+			seen[section] = true
+		case "stat":
+			// cpu user nice system idle iowait irq softirq steal ...
+			if fields[0] != "cpu" || len(fields) < 5 {
+				continue
+			}
+			var total, idle uint64
+			for i, f := range fields[1:] {
+				if i >= 8 {
+					// guest は user に含まれている
+					break
+				}
+				v, _ := strconv.ParseUint(f, 10, 64)
+				total += v
+				if i == 3 || i == 4 {
+					idle += v
+				}
+			}
+			s.CPUTotal = total
+			s.CPUBusy = total - idle
+			seen[section] = true
+		case "netdev":
+			// "  eth0: rx_bytes ... tx_bytes ..."
+			name, rest, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			name = strings.TrimSpace(name)
+			cols := strings.Fields(rest)
+			if name == "lo" || len(cols) < 9 {
+				continue
+			}
+			rx, _ := strconv.ParseUint(cols[0], 10, 64)
+			tx, _ := strconv.ParseUint(cols[8], 10, 64)
+			s.NetRx += rx
+			s.NetTx += tx
+			seen[section] = true
+		case "df":
+			// Filesystem 1024-blocks Used Available Capacity Mounted on
+			if len(fields) < 6 || fields[0] == "Filesystem" || skipFilesystems[fields[0]] {
+				continue
+			}
+			total, err1 := strconv.ParseUint(fields[1], 10, 64)
+			used, err2 := strconv.ParseUint(fields[2], 10, 64)
+			if err1 != nil || err2 != nil || total == 0 {
+				continue
+			}
+			s.Disks = append(s.Disks, Disk{
+				Mount: strings.Join(fields[5:], " "),
+				Total: total * 1024,
+				Used:  used * 1024,
+			})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"loadavg", "meminfo", "stat"} {
+		if !seen[name] {
+			return nil, fmt.Errorf("could not read %s (is the host running Linux?)", name)
+		}
+	}
+	return s, nil
+}
+
+// Sample computes the metrics of cur. Rates are measured against prev,
+// which may be nil for the first snapshot.
+func (cur *Snapshot) Sample(prev *Snapshot) Sample {
+	smp := Sample{
+		Time:      cur.Time,
+		Load:      cur.Load,
+		MemTotal:  cur.MemTotal,
+		MemUsed:   cur.MemTotal - min(cur.MemAvail, cur.MemTotal),
+		SwapTotal: cur.SwapTotal,
+		SwapUsed:  cur.SwapTotal - min(cur.SwapFree, cur.SwapTotal),
+		Disks:     cur.Disks,
+	}
+	if smp.Disks == nil {
+		smp.Disks = []Disk{}
+	}
+	if prev == nil {
+		return smp
+	}
+	if dt := cur.CPUTotal - prev.CPUTotal; cur.CPUTotal > prev.CPUTotal {
+		smp.CPU = float64(cur.CPUBusy-min(prev.CPUBusy, cur.CPUBusy)) / float64(dt) * 100
+	}
+	if secs := cur.Time.Sub(prev.Time).Seconds(); secs > 0 {
+		// カウンタがリセットされた場合は 0 とする
+		if cur.NetRx >= prev.NetRx {
+			smp.NetRx = float64(cur.NetRx-prev.NetRx) / secs
+		}
+		if cur.NetTx >= prev.NetTx {
+			smp.NetTx = float64(cur.NetTx-prev.NetTx) / secs
+		}
+	}
+	return smp
+}
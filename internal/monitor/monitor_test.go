@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Debian 12 の VM で Script を実行した出力
+const sampleOutput = `##loadavg
+0.52 0.58 0.59 2/311 14523
+##meminfo
+MemTotal:        4013928 kB
+MemFree:          612340 kB
+MemAvailable:    2843120 kB
+Buffers:          101236 kB
+Cached:          2001228 kB
+SwapCached:         1024 kB
+SwapTotal:       1048572 kB
+SwapFree:         917500 kB
+##stat
+cpu  10132153 290696 3084719 46828483 16683 0 25195 0 175628 0
+##netdev
+Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 2776770   22532    0    0    0     0          0         0  2776770   22532    0    0    0     0       0          0
+  eth0: 1215645   2751    0    0    0     0          0         0  1782404   4324    0    0    0     0       0          0
+  eth1: 1000   10    0    0    0     0          0         0  2000   20    0    0    0     0       0          0
+##df
+Filesystem     1024-blocks     Used Available Capacity Mounted on
+udev               1989600        0   1989600       0% /dev
+tmpfs               401396      912    400484       1% /run
+/dev/sda1         30832548 12054032  17187192      42% /
+/dev/sdb1        103081248 52428800  45396368      54% /mnt/my data
+`
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s, err := Parse(sampleOutput, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Snapshot{
+		Time:      now,
+		Load:      [3]float64{0.52, 0.58, 0.59},
+		MemTotal:  4013928 * 1024,
+		MemAvail:  2843120 * 1024,
+		SwapTotal: 1048572 * 1024,
+		SwapFree:  917500 * 1024,
+		// user..steal の合計。guest は user に含まれるので数えない
+		CPUTotal: 10132153 + 290696 + 3084719 + 46828483 + 16683 + 0 + 25195 + 0,
+		CPUBusy:  10132153 + 290696 + 3084719 + 0 + 25195 + 0,
+		NetRx:    1215645 + 1000,
+		NetTx:    1782404 + 2000,
+		Disks: []Disk{
+			{Mount: "/", Total: 30832548 * 1024, Used: 12054032 * 1024},
+			{Mount: "/mnt/my data", Total: 103081248 * 1024, Used: 52428800 * 1024},
+		},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Parse =\n%+v\nwant\n%+v", s, want)
+	}
+}
+
+func TestParseMissingSection(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"empty", ""},
+		{"no stat", "##loadavg\n0.1 0.2 0.3 1/1 1\n##meminfo\nMemTotal: 1 kB\n##stat\n"},
+		{"no loadavg", "##meminfo\nMemTotal: 1 kB\n##stat\ncpu  1 2 3 4\n"},
+		{"malformed loadavg", "##loadavg\n0.1\n##meminfo\nMemTotal: 1 kB\n##stat\ncpu  1 2 3 4\n"},
+		// /proc のない BSD や macOS
+		{"not linux", "##loadavg\ncat: /proc/loadavg: No such file or directory\n"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.out, time.Now()); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	base := Snapshot{
+		Time:      t0,
+		Load:      [3]float64{1, 2, 3},
+		MemTotal:  1000,
+		MemAvail:  400,
+		SwapTotal: 100,
+		SwapFree:  100,
+		CPUBusy:   500,
+		CPUTotal:  2000,
+		NetRx:     10000,
+		NetTx:     20000,
+	}
+	later := func(busy, total, rx, tx uint64, d time.Duration) *Snapshot {
+		s := base
+		s.Time = t0.Add(d)
+		s.CPUBusy, s.CPUTotal, s.NetRx, s.NetTx = busy, total, rx, tx
+		return &s
+	}
+
+	tests := []struct {
+		name          string
+		cur, prev     *Snapshot
+		cpu, rxs, txs float64
+	}{
+		// 最初のサンプルは差分がないので 0
+		{"first sample", &base, nil, 0, 0, 0},
+		{"no cpu delta", later(500, 2000, 10000, 20000, 2*time.Second), &base, 0, 0, 0},
+		{"same time", later(600, 2100, 12000, 22000, 0), &base, 100, 0, 0},
+		{"busy quarter", later(550, 2200, 12000, 21000, 2*time.Second), &base, 25, 1000, 500},
+		{"counter reset", later(10, 20, 5, 5, time.Second), &base, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		smp := tt.cur.Sample(tt.prev)
+		if math.IsNaN(smp.CPU) || smp.CPU != tt.cpu || smp.NetRx != tt.rxs || smp.NetTx != tt.txs {
+			t.Errorf("%s: cpu %v rx %v tx %v, want %v %v %v", tt.name, smp.CPU, smp.NetRx, smp.NetTx, tt.cpu, tt.rxs, tt.txs)
+		}
+		if smp.MemUsed != 600 || smp.SwapUsed != 0 || smp.Disks == nil {
+			t.Errorf("%s: mem %d swap %d disks %v", tt.name, smp.MemUsed, smp.SwapUsed, smp.Disks)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PSArgs is the ps invocation parsed by ParseProcesses
+var PSArgs = []string{"ps", "-e", "-ww", "-o", "pid=,ppid=,user:32=,pcpu=,pmem=,rss=,etimes=,args="}
+
+// Process is a process on the remote host
+type Process struct {
+	PID     int       `json:"pid"`
+	PPID    int       `json:"ppid"`
+	User    string    `json:"user"`
+	CPU     float64   `json:"cpu"` // %
+	Mem     float64   `json:"mem"` // %
+	RSS     uint64    `json:"rss"` // bytes
+	Started time.Time `json:"started"`
+	Command string    `json:"command"`
+}
+
+// ParseProcesses parses the output of PSArgs. now is used to turn the
+// elapsed time of each process into its start time.
+func ParseProcesses(out string, now time.Time) ([]Process, error) {
+	var procs []Process
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields, rest := splitFields(line, 7)
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("malformed ps line: %q", line)
+		}
+		var p Process
+		var err error
+		if p.PID, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, fmt.Errorf("malformed pid: %q", line)
+		}
+		p.PPID, _ = strconv.Atoi(fields[1])
+		p.User = fields[2]
+		p.CPU, _ = strconv.ParseFloat(fields[3], 64)
+		p.Mem, _ = strconv.ParseFloat(fields[4], 64)
+		rss, _ := strconv.ParseUint(fields[5], 10, 64)
+		p.RSS = rss * 1024
+		etimes, _ := strconv.ParseInt(fields[6], 10, 64)
+		p.Started = now.Add(-time.Duration(etimes) * time.Second).Truncate(time.Second)
+		p.Command = rest
+		procs = append(procs, p)
+	}
+	return procs, nil
+}
+
+// splitFields splits the first n whitespace separated fields of s and
+// returns them with the remainder of the line
+func splitFields(s string, n int) ([]string, string) {
+	var fields []string
+	for len(fields) < n {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		end := strings.IndexAny(s, " \t")
+		if end < 0 {
+			fields = append(fields, s)
+			s = ""
+			break
+		}
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+	return fields, strings.TrimSpace(s)
+}
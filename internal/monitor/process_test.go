@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProcesses(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	// ps -e -ww -o pid=,ppid=,user:32=,pcpu=,pmem=,rss=,etimes=,args= の出力
+	out := `      1       0 root                              0.0  0.3 13200 864000 /sbin/init
+      2       0 root                              0.0  0.0     0 864000 [kthreadd]
+    812       1 systemd-network                   0.0  0.2  8960 863990 /lib/systemd/systemd-networkd
+  14210   14201 alice                            12.5  4.1 168432     65 python3 -m http.server 8000  --bind 127.0.0.1
+  14523   14210 alice                             0.0  0.0  3420      0 ps -e -ww -o pid=,ppid=,user:32=,pcpu=,pmem=,rss=,etimes=,args=
+
+`
+	got, err := ParseProcesses(out, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := now.Truncate(time.Second)
+	want := []Process{
+		{PID: 1, PPID: 0, User: "root", CPU: 0, Mem: 0.3, RSS: 13200 * 1024, Started: base.Add(-864000 * time.Second), Command: "/sbin/init"},
+		{PID: 2, PPID: 0, User: "root", RSS: 0, Started: base.Add(-864000 * time.Second), Command: "[kthreadd]"},
+		{PID: 812, PPID: 1, User: "systemd-network", Mem: 0.2, RSS: 8960 * 1024, Started: base.Add(-863990 * time.Second), Command: "/lib/systemd/systemd-networkd"},
+		// 引数の中の連続した空白はそのまま残る
+		{PID: 14210, PPID: 14201, User: "alice", CPU: 12.5, Mem: 4.1, RSS: 168432 * 1024, Started: base.Add(-65 * time.Second), Command: "python3 -m http.server 8000  --bind 127.0.0.1"},
+		{PID: 14523, PPID: 14210, User: "alice", RSS: 3420 * 1024, Started: base, Command: "ps -e -ww -o pid=,ppid=,user:32=,pcpu=,pmem=,rss=,etimes=,args="},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProcesses =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseProcessesMalformed(t *testing.T) {
+	for _, out := range []string{
+		"  1 0 root 0.0 0.3",
+		"pid ppid user cpu mem rss etimes cmd",
+		"ps: unknown user-defined format specifier \"etimes\"",
+	} {
+		if _, err := ParseProcesses(out, time.Now()); err == nil {
+			t.Errorf("ParseProcesses(%q) succeeded, want an error", out)
+		}
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+	tests := []struct {
+		in     string
+		n      int
+		fields []string
+		rest   string
+	}{
+		{"a b c", 2, []string{"a", "b"}, "c"},
+		{"  a\tb   c  d  ", 2, []string{"a", "b"}, "c  d"},
+		{"a b", 3, []string{"a", "b"}, ""},
+		{"", 1, nil, ""},
+	}
+	for _, tt := range tests {
+		fields, rest := splitFields(tt.in, tt.n)
+		if !reflect.DeepEqual(fields, tt.fields) || rest != tt.rest {
+			t.Errorf("splitFields(%q, %d) = %q, %q, want %q, %q", tt.in, tt.n, fields, rest, tt.fields, tt.rest)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/archive"
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// archiveFindArgs prints type, size, mtime, mode, link target and path
+// of each file, every field terminated by NUL so that any name is safe.
+// Files that cannot be read are reported with type "x" and skipped.
+var archiveFindArgs = []string{
+	"(", "-type", "f", "!", "-readable", "-printf", `x\0%s\0%T@\0%m\0%l\0%p\0`, ")",
+	"-o", "-printf", `%y\0%s\0%T@\0%m\0%l\0%p\0`,
+}
+
+const archiveFindFields = 6
+
+// archiveSource is a file found below one of the selected paths
+type archiveSource struct {
+	archive.Entry
+	Abs string
+}
+
+// archiveBaseName is the top-level name of a selected path in the archive
+func archiveBaseName(abs string) string {
+	base := path.Base(abs)
+	if base == "/" {
+		return "root"
+	}
+	return base
+}
+
+// uniqueName returns name, or "name (2)", "name (3)"... if it is already
+// used. The number goes before the extension of file names.
+func uniqueName(used map[string]bool, name string, isDir bool) string {
+	stem, ext := name, ""
+	if !isDir {
+		ext = path.Ext(name)
+		if ext == name {
+			// ".bashrc" のようなドットファイルは拡張子とみなさない
+			ext = ""
+		}
+		stem = strings.TrimSuffix(name, ext)
+	}
+	unique := name
+	for n := 2; used[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)%s", stem, n, ext)
+	}
+	used[unique] = true
+	return unique
+}
+
+// listArchiveSources lists abs and everything below it. Entry names start
+// with the base name of abs, so a selected folder becomes a folder in the archive.
+func listArchiveSources(ctx context.Context, client *ssh.Client, abs string) ([]archiveSource, error) {
+	argv := append([]string{"find", "-H", abs}, archiveFindArgs...)
+	res, err := command.Run(ctx, client, argv...)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		// 読めないディレクトリがあっても見つかった分はアーカイブする
+		logger.Warn("find %s exited with %d: %s", abs, res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+
+	base := archiveBaseName(abs)
+	fields := strings.Split(res.Stdout, "\x00")
+	var sources []archiveSource
+	for i := 0; i+archiveFindFields <= len(fields); i += archiveFindFields {
+		f := fields[i : i+archiveFindFields]
+		p := f[5]
+		if !isWithin(abs, p) {
+			continue
+		}
+		name := base + strings.TrimPrefix(p, abs)
+
+		var typ string
+		switch f[0] {
+		case "f":
+			typ = archive.File
+		case "d":
+			typ = archive.Dir
+		case "l":
+			typ = archive.Symlink
+		case "x":
+			logger.Warn("Skipping unreadable file in archive: %s", p)
+			continue
+		default:
+			// デバイスや FIFO などは含めない
+			continue
+		}
+		size, _ := strconv.ParseInt(f[1], 10, 64)
+		mtime, _ := strconv.ParseFloat(f[2], 64)
+		mode, _ := strconv.ParseUint(f[3], 8, 32)
+		sources = append(sources, archiveSource{
+			Entry: archive.Entry{
+				Name:    name,
+				Type:    typ,
+				Size:    size,
+				Mode:    fs.FileMode(mode),
+				ModTime: time.Unix(int64(mtime), 0),
+				Link:    f[4],
+			},
+			Abs: p,
+		})
+	}
+	return sources, nil
+}
+
+// splitPatterns splits the exclude field on newlines and commas
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// driveArchiveHandler streams the selected files and folders as a ZIP or
+// tar.gz archive. It is submitted as a form so the browser saves the
+// response directly.
+// Form: path (repeated), format ("zip" or "tar.gz"), exclude
+func driveArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+	if !checkCSRF(w, r) {
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = archive.Zip
+	}
+	if format != archive.Zip && format != archive.TarGz {
+		writeJSONError(w, http.StatusBadRequest, "Unsupported archive format")
+		return
+	}
+	paths := r.Form["path"]
+	if len(paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No files selected")
+		return
+	}
+	excludes := splitPatterns(r.FormValue("exclude"))
+
+	auth := authFromContext(r)
+	var sources []archiveSource
+	var first string
+	// 同じ名前のフォルダを複数選んでも上書きされないよう、トップレベルの名前を重複させない
+	used := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		_, abs, ok := requestPath(w, r, p)
+		if !ok {
+			return
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		found, err := listArchiveSources(r.Context(), auth.Client, abs)
+		if err != nil {
+			logger.Err("Failed to list %s: %v", abs, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to list files")
+			return
+		}
+		if len(found) > 0 {
+			// find は選択したパス自身を最初に出力する
+			base := archiveBaseName(abs)
+			if name := uniqueName(used, base, found[0].Type == archive.Dir); name != base {
+				for i := range found {
+					found[i].Name = name + strings.TrimPrefix(found[i].Name, base)
+				}
+			}
+		}
+		if first == "" {
+			first = abs
+		}
+		sources = append(sources, found...)
+	}
+
+	// 1 つだけならその名前、複数なら親フォルダの名前をファイル名にする
+	name := path.Base(first)
+	if len(paths) > 1 {
+		name = path.Base(path.Dir(first))
+	}
+	if name == "/" || name == "." {
+		name = "tune"
+	}
+	w.Header().Set("Content-Type", archive.ContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+
+	aw, _ := archive.New(format, w)
+	count := 0
+	for _, src := range sources {
+		if archive.Excluded(excludes, src.Name) {
+			continue
+		}
+		if err := addArchiveSource(aw, auth.Client, src); err != nil {
+			// 途中で失敗した場合は壊れたアーカイブを完成させず接続を切る
+			logger.Err("Archive of %s aborted at %s: %v", auth.UserHost(), src.Abs, err)
+			panic(http.ErrAbortHandler)
+		}
+		count++
+	}
+	if err := aw.Close(); err != nil {
+		logger.Err("Failed to finish archive: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+	logger.Info("Archive %s.%s sent to %s (%d entries)", name, format, auth.UserHost(), count)
+}
+
+func addArchiveSource(aw archive.Writer, client *ssh.Client, src archiveSource) error {
+	if src.Type != archive.File {
+		return aw.Add(src.Entry, nil)
+	}
+	rc, err := openRemote(client, src.Abs, 0, -1)
+	if err != nil {
+		return fmt.Errorf("open: %v", err)
+	}
+	defer rc.Close()
+	return aw.Add(src.Entry, rc)
+}
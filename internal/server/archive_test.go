@@ -0,0 +1,46 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUniqueName(t *testing.T) {
+	used := make(map[string]bool)
+	steps := []struct {
+		name  string
+		isDir bool
+		want  string
+	}{
+		{"logs", true, "logs"},
+		{"logs", true, "logs (2)"},
+		{"logs", true, "logs (3)"},
+		{"report.txt", false, "report.txt"},
+		{"report.txt", false, "report (2).txt"},
+		{".bashrc", false, ".bashrc"},
+		{".bashrc", false, ".bashrc (2)"},
+		{"v1.2", true, "v1.2"},
+		{"v1.2", true, "v1.2 (2)"},
+	}
+	for _, s := range steps {
+		if got := uniqueName(used, s.name, s.isDir); got != s.want {
+			t.Errorf("uniqueName(%q) = %q, want %q", s.name, got, s.want)
+		}
+	}
+}
+
+func TestArchiveBaseName(t *testing.T) {
+	for abs, want := range map[string]string{"/": "root", "/home/u/logs": "logs", "/a/b.txt": "b.txt"} {
+		if got := archiveBaseName(abs); got != want {
+			t.Errorf("archiveBaseName(%q) = %q, want %q", abs, got, want)
+		}
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	got := splitPatterns(" node_modules, *.log\n\n.git ,")
+	want := []string{"node_modules", "*.log", ".git"}
+	if !slices.Equal(got, want) {
+		t.Errorf("splitPatterns = %q, want %q", got, want)
+	}
+}
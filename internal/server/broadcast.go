@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+// TerminalInfo describes an open terminal and its broadcast group
+type TerminalInfo struct {
+	ID     string    `json:"id"`
+	Title  string    `json:"title"`
+	Group  string    `json:"group,omitempty"`
+	Opened time.Time `json:"opened"`
+}
+
+// openTerminal is a terminal WebSocket that is currently open. Terminals
+// of the same tune session can be put in a group; input typed into any
+// member of a group is then written to the stdin of every member, while
+// each terminal keeps its own output. Input from other members is queued
+// and written by the terminal's own goroutine, so a stalled session does
+// not hold up the rest of its group.
+type openTerminal struct {
+	TerminalInfo
+	owner     string
+	stdin     io.Writer
+	mu        sync.Mutex // stdin への書き込みを直列化
+	broadcast chan []byte
+}
+
+// 他のターミナルから転送される入力を溜めておける数
+const broadcastQueue = 256
+
+// forward writes input broadcast from other group members until the
+// terminal is removed
+func (t *openTerminal) forward() {
+	for p := range t.broadcast {
+		t.mu.Lock()
+		_, err := t.stdin.Write(p)
+		t.mu.Unlock()
+		if err != nil {
+			logger.Debug("Broadcast: Write to terminal %s failed: %v", t.ID, err)
+		}
+	}
+}
+
+// TerminalRegistry tracks the open terminals of every session
+type TerminalRegistry struct {
+	mu    sync.Mutex
+	terms map[string]*openTerminal
+}
+
+// NewTerminalRegistry creates an empty registry
+func NewTerminalRegistry() *TerminalRegistry {
+	return &TerminalRegistry{terms: make(map[string]*openTerminal)}
+}
+
+// Add registers a terminal owned by the session
+func (tr *TerminalRegistry) Add(owner, title string, stdin io.Writer) *openTerminal {
+	t := &openTerminal{
+		TerminalInfo: TerminalInfo{ID: uuid.New().String(), Title: title, Opened: time.Now()},
+		owner:        owner,
+		stdin:        stdin,
+		broadcast:    make(chan []byte, broadcastQueue),
+	}
+	go t.forward()
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.terms[t.ID] = t
+	return t
+}
+
+// Remove unregisters a terminal when its WebSocket closes
+func (tr *TerminalRegistry) Remove(id string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if t, ok := tr.terms[id]; ok {
+		delete(tr.terms, id)
+		close(t.broadcast)
+	}
+}
+
+// List returns the session's terminals, oldest first
+func (tr *TerminalRegistry) List(owner string) []TerminalInfo {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	list := []TerminalInfo{}
+	for _, t := range tr.terms {
+		if t.owner == owner {
+			list = append(list, t.TerminalInfo)
+		}
+	}
+	slices.SortFunc(list, func(a, b TerminalInfo) int { return a.Opened.Compare(b.Opened) })
+	return list
+}
+
+// SetGroup moves the session's terminals in ids to group, or out of any
+// group if group is empty. It returns the number of terminals changed.
+func (tr *TerminalRegistry) SetGroup(owner string, ids []string, group string) int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	n := 0
+	for _, id := range ids {
+		if t, ok := tr.terms[id]; ok && t.owner == owner {
+			t.Group = group
+			n++
+		}
+	}
+	return n
+}
+
+// Input writes p to the stdin of t and queues it for every other terminal
+// in its group. Only an error writing to t itself is returned.
+func (tr *TerminalRegistry) Input(t *openTerminal, p []byte) error {
+	tr.mu.Lock()
+	if t.Group != "" {
+		for _, o := range tr.terms {
+			if o == t || o.owner != t.owner || o.Group != t.Group {
+				continue
+			}
+			// 詰まったターミナルを待たず、キューが溢れた入力は捨てる
+			select {
+			case o.broadcast <- bytes.Clone(p):
+			default:
+				logger.Warn("Broadcast: Input to terminal %s dropped, it is not reading", o.ID)
+			}
+		}
+	}
+	tr.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.stdin.Write(p)
+	return err
+}
+
+var terminals = NewTerminalRegistry()
+
+func RegisterBroadcastHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/broadcast", requireAuth(broadcastPageHandler))
+	mux.HandleFunc("/api/terminals", requireAuth(terminalListHandler))
+	mux.HandleFunc("/api/terminals/group", requireAuth(terminalGroupHandler))
+	mux.HandleFunc("/api/terminals/ungroup", requireAuth(terminalUngroupHandler))
+}
+
+func broadcastPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/broadcast accessed")
+	renderTemplate(w, r, "broadcast", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func terminalListHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, terminals.List(authFromContext(r).SessionID))
+}
+
+// terminalGroupHandler puts the selected terminals in a new broadcast group
+// Body: {"ids": [...]}
+func terminalGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if len(req.IDs) < 2 {
+		writeJSONError(w, http.StatusBadRequest, "Select at least two terminals")
+		return
+	}
+	auth := authFromContext(r)
+	group := uuid.New().String()
+	n := terminals.SetGroup(auth.SessionID, req.IDs, group)
+	if n < 2 {
+		writeJSONError(w, http.StatusNotFound, "Terminals not found")
+		terminals.SetGroup(auth.SessionID, req.IDs, "")
+		return
+	}
+	logger.Info("Broadcast (%s): %d terminals grouped", auth.UserHost(), n)
+	writeJSON(w, map[string]string{"group": group})
+}
+
+// terminalUngroupHandler stops broadcasting to the selected terminals
+// Body: {"ids": [...]}
+func terminalUngroupHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	terminals.SetGroup(authFromContext(r).SessionID, req.IDs, "")
+	writeJSON(w, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the forwarding goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// blockedWriter never returns, like the stdin of a stalled session
+type blockedWriter struct{ release chan struct{} }
+
+func (w blockedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+// waitFor polls until b contains want
+func waitFor(t *testing.T, b *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.String() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %q, want %q", b.String(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTerminalRegistryInput(t *testing.T) {
+	tr := NewTerminalRegistry()
+	var a, b, c, other syncBuffer
+	ta := tr.Add("s1", "a", &a)
+	tb := tr.Add("s1", "b", &b)
+	tr.Add("s1", "c", &c)
+	to := tr.Add("s2", "other", &other)
+
+	// 他のセッションのターミナルはグループに入れられない
+	if n := tr.SetGroup("s1", []string{ta.ID, tb.ID, to.ID}, "g"); n != 2 {
+		t.Fatalf("SetGroup changed %d terminals, want 2", n)
+	}
+	if err := tr.Input(ta, []byte("ls\r")); err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != "ls\r" {
+		t.Errorf("a got %q, want %q", a.String(), "ls\r")
+	}
+	waitFor(t, &b, "ls\r")
+	if c.String() != "" || other.String() != "" {
+		t.Errorf("input leaked outside the group: c=%q other=%q", c.String(), other.String())
+	}
+
+	tr.SetGroup("s1", []string{ta.ID}, "")
+	a.Reset()
+	b.Reset()
+	tr.Input(ta, []byte("x"))
+	time.Sleep(20 * time.Millisecond)
+	if a.String() != "x" || b.String() != "" {
+		t.Errorf("after ungroup got a=%q b=%q", a.String(), b.String())
+	}
+
+	tr.Remove(tb.ID)
+	if list := tr.List("s1"); len(list) != 2 {
+		t.Errorf("List returned %d terminals, want 2", len(list))
+	}
+}
+
+func TestTerminalRegistryStalledMember(t *testing.T) {
+	tr := NewTerminalRegistry()
+	stalled := blockedWriter{release: make(chan struct{})}
+	defer close(stalled.release)
+	var a, c syncBuffer
+	ta := tr.Add("s1", "a", &a)
+	tb := tr.Add("s1", "stalled", stalled)
+	tc := tr.Add("s1", "c", &c)
+	tr.SetGroup("s1", []string{ta.ID, tb.ID, tc.ID}, "g")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range broadcastQueue + 10 {
+			tr.Input(ta, []byte("y"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Input blocked on a stalled group member")
+	}
+	if got := len(a.String()); got != broadcastQueue+10 {
+		t.Errorf("a got %d bytes, want %d", got, broadcastQueue+10)
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/container"
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+var errNoContainerRuntime = errors.New("neither docker nor podman was found on the host")
+
+func RegisterContainerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/containers", requireAuth(containersPageHandler))
+	mux.HandleFunc("/containers/logs", requireAuth(containerLogsPageHandler))
+	mux.HandleFunc("/containers/logs/ws", requireAuth(containerLogsWSHandler))
+	mux.HandleFunc("/containers/exec", requireAuth(containerExecPageHandler))
+	mux.HandleFunc("/containers/exec/ws", requireAuth(containerExecWSHandler))
+	mux.HandleFunc("/api/containers", requireAuth(containerListHandler))
+	mux.HandleFunc("/api/containers/action", requireAuth(containerActionHandler))
+}
+
+// containerRuntime detects the container CLI of the connected host
+func containerRuntime(ctx context.Context, auth *AuthContext) (string, error) {
+	out, err := command.Output(ctx, auth.Client, "sh", "-c", container.DetectScript)
+	if err != nil {
+		return "", errNoContainerRuntime
+	}
+	rt := container.Runtime(out)
+	if rt == "" {
+		return "", errNoContainerRuntime
+	}
+	return rt, nil
+}
+
+// requestRuntime detects the runtime and validates the id parameter,
+// writing a JSON error and returning false on failure
+func requestRuntime(w http.ResponseWriter, r *http.Request, id string) (string, bool) {
+	if !container.ValidID(id) {
+		writeJSONError(w, http.StatusBadRequest, "Invalid container id")
+		return "", false
+	}
+	rt, err := containerRuntime(r.Context(), authFromContext(r))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return "", false
+	}
+	return rt, true
+}
+
+func containersPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/containers accessed")
+	renderTemplate(w, r, "containers", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func containerListHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	rt, err := containerRuntime(r.Context(), auth)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	out, err := command.Output(r.Context(), auth.Client, privileged(auth.Host, container.PSArgs(rt)...)...)
+	if err != nil {
+		logger.Err("Failed to list containers (%s): %v", rt, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list containers: "+err.Error())
+		return
+	}
+	containers := container.ParseContainers(out)
+
+	images := []container.Image{}
+	if out, err := command.Output(r.Context(), auth.Client, privileged(auth.Host, container.ImagesArgs(rt)...)...); err == nil {
+		images = container.ParseImages(out)
+	} else {
+		logger.Warn("Failed to list images (%s): %v", rt, err)
+	}
+
+	writeJSON(w, struct {
+		Runtime    string                `json:"runtime"`
+		Containers []container.Container `json:"containers"`
+		Images     []container.Image     `json:"images"`
+	}{rt, containers, images})
+}
+
+func containerActionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     string `json:"id"`
+		Action string `json:"action"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if !container.Actions[req.Action] {
+		writeJSONError(w, http.StatusBadRequest, "Unsupported action: "+req.Action)
+		return
+	}
+	rt, ok := requestRuntime(w, r, req.ID)
+	if !ok {
+		return
+	}
+	auth := authFromContext(r)
+
+	res, err := command.Run(r.Context(), auth.Client, privileged(auth.Host, container.ActionArgs(rt, req.Action, req.ID)...)...)
+	if err != nil {
+		logger.Err("Container %s %s failed (%s): %v", req.Action, req.ID, auth.UserHost(), err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to run "+rt)
+		return
+	}
+	if res.ExitCode != 0 {
+		msg := strings.TrimSpace(res.Stderr)
+		logger.Warn("Container %s %s exited with %d (%s): %s", req.Action, req.ID, res.ExitCode, auth.UserHost(), msg)
+		writeJSONError(w, http.StatusBadGateway, msg)
+		return
+	}
+	logger.Info("Container %s %s by %s", req.Action, req.ID, auth.UserHost())
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+func containerLogsPageHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	renderTemplate(w, r, "tail", followPageData{
+		UserHost: authFromContext(r).UserHost(),
+		Title:    "logs: " + id,
+		Source:   "/containers/logs/ws?id=" + url.QueryEscape(id),
+	})
+}
+
+func containerLogsWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	id := r.URL.Query().Get("id")
+	rt, ok := requestRuntime(w, r, id)
+	if !ok {
+		return
+	}
+	lines := tailDefaultLines
+	if n, err := strconv.Atoi(r.URL.Query().Get("lines")); err == nil && n >= 0 {
+		lines = min(n, tailMaxLines)
+	}
+
+	logger.Info("Container logs (%s): %s", auth.UserHost(), id)
+	followLines(w, r, privileged(auth.Host, container.LogsArgs(rt, id, strconv.Itoa(lines))...), rt+" logs "+id)
+}
+
+func containerExecPageHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	renderTemplate(w, r, "terminal", terminalPageData{
+		Title:  "exec: " + id,
+		Socket: "/containers/exec/ws?id=" + url.QueryEscape(id),
+	})
+}
+
+func containerExecWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	id := r.URL.Query().Get("id")
+	rt, ok := requestRuntime(w, r, id)
+	if !ok {
+		return
+	}
+
+	logger.Info("Container exec (%s): %s", auth.UserHost(), id)
+	servePTY(w, r, command.Join(privileged(auth.Host, container.ExecArgs(rt, id)...)...), false)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+// CSRFトークンのフォーム名とヘッダー名
+const (
+	csrfFormField = "csrf_token"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// csrfToken returns the CSRF token of the session, creating one if needed.
+// It must be called before anything is written to the response.
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	sess, err := getSession(r)
+	if err != nil {
+		return "", err
+	}
+	if token, ok := sess.Values[csrfFormField].(string); ok && token != "" {
+		return token, nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	sess.Values[csrfFormField] = token
+	if err := sess.Save(r, w); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// validCSRF checks the token sent in the form or header against the session
+func validCSRF(r *http.Request) bool {
+	sess, err := getSession(r)
+	if err != nil {
+		return false
+	}
+	expected, ok := sess.Values[csrfFormField].(string)
+	if !ok || expected == "" {
+		return false
+	}
+
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.FormValue(csrfFormField)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// checkCSRF rejects the request with 403 if the CSRF token is invalid
+func checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if validCSRF(r) {
+		return true
+	}
+	logger.Warn("CSRF token mismatch: %s %s from %s", r.Method, r.URL.Path, clientIP(r))
+	if isAPIRequest(r) {
+		writeJSONError(w, http.StatusForbidden, "Invalid CSRF token")
+	} else {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+	}
+	return false
+}
+
+// checkOrigin allows same-origin WebSocket requests and origins on the allowlist
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// ブラウザ以外のクライアント
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		logger.Warn("WebSocket: Invalid Origin header: %s", origin)
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range conf.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	logger.Warn("WebSocket: Origin not allowed: %s", origin)
+	return false
+}
@@ -1,19 +1,20 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
-	"html/template"
+	"encoding/binary"
 	"io"
+	"mime"
 	"net/http"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 
-	"github.com/gorilla/sessions"
 	"github.com/rxxuzi/tune/internal/command"
 	"github.com/rxxuzi/tune/internal/logger"
-	"github.com/rxxuzi/tune/internal/static"
+	"github.com/rxxuzi/tune/internal/textenc"
 )
 
 type DriveItem struct {
@@ -28,34 +29,22 @@ type DriveTemplateData struct {
 }
 
 func RegisterDriveHandlers(mux *http.ServeMux) {
-	mux.HandleFunc("/drive/", driveHandler)
-	mux.HandleFunc("/api/drive/list", driveAPIHandler)
-	mux.HandleFunc("/api/drive/preview", drivePreviewHandler)
-	mux.HandleFunc("/api/drive/download", driveDownloadHandler)
+	mux.HandleFunc("/drive/", requireAuth(driveHandler))
+	mux.HandleFunc("/api/drive/list", requireAuth(driveAPIHandler))
+	mux.HandleFunc("/api/drive/preview", requireAuth(drivePreviewHandler))
+	mux.HandleFunc("/api/drive/download", requireAuth(driveDownloadHandler))
+	mux.HandleFunc("/api/drive/raw", requireAuth(driveRawHandler))
+	mux.HandleFunc("/api/drive/text", requireAuth(driveTextHandler))
+	mux.HandleFunc("/api/drive/thumb", requireAuth(driveThumbHandler))
+	mux.HandleFunc("/api/drive/archive", requireAuth(driveArchiveHandler))
+	mux.HandleFunc("/api/drive/search", requireAuth(driveSearchHandler))
+	mux.HandleFunc("/api/drive/stat", requireAuth(driveStatHandler))
+	mux.HandleFunc("/api/drive/chmod", requireAuth(driveChmodHandler))
+	mux.HandleFunc("/api/drive/chown", requireAuth(driveChownHandler))
+	startThumbCachePruning()
 }
 
 func driveHandler(w http.ResponseWriter, r *http.Request) {
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	logger.Debug("/drive accessed")
 
 	// サブパス解析: /drive/ の後ろをサブパスとして扱う
@@ -63,91 +52,37 @@ func driveHandler(w http.ResponseWriter, r *http.Request) {
 	subPath = strings.TrimPrefix(subPath, "/")
 
 	data := DriveTemplateData{
-		UserHost: getUserHost(sess),
+		UserHost: authFromContext(r).UserHost(),
 		SubPath:  subPath,
 	}
 
-	renderDriveTemplate(w, "drive.html", data)
-}
-
-func getUserHost(sess *sessions.Session) string {
-	user, ok1 := sess.Values["user"].(string)
-	host, ok2 := sess.Values["host"].(string)
-	if ok1 && ok2 {
-		return fmt.Sprintf("%s@%s", user, host)
-	}
-	return "Unknown"
-}
-
-func renderDriveTemplate(w http.ResponseWriter, tmplName string, data DriveTemplateData) {
-	tmpl, err := template.ParseFS(static.SubFS, tmplName)
-	if err != nil {
-		logger.Err("Failed to load template (%s): %v", tmplName, err)
-		http.Error(w, "Template loading error", http.StatusInternalServerError)
-		return
-	}
-	if err := tmpl.Execute(w, data); err != nil {
-		logger.Err("Failed to execute template (%s): %v", tmplName, err)
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-	}
-	logger.Debug("Temple Render Done.")
+	renderTemplate(w, r, "drive", data)
 }
 
 func driveAPIHandler(w http.ResponseWriter, r *http.Request) {
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
-		return
-	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Error(w, "Invalid session", http.StatusBadRequest)
-		return
-	}
+	client := authFromContext(r).Client
 
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
+	root, remotePath, ok := requestPath(w, r, r.URL.Query().Get("path"))
+	if !ok {
 		return
 	}
-
-	remotePath := r.URL.Query().Get("path")
-	homeDir, err := command.ExecuteCommand(client, "echo $HOME")
-	if err != nil {
-		logger.Err("Failed to get home directory: %v", err)
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
-		return
-	}
-	homeDir = strings.TrimSpace(homeDir)
-
-	if remotePath == "" {
-		remotePath = homeDir
-	} else {
-		// 絶対パス化
-		if !strings.HasPrefix(remotePath, homeDir) {
-			remotePath = path.Join(homeDir, remotePath)
-		}
-	}
+	relPath := relativePath(root, remotePath)
 
 	// フォルダを取得
-	cmdFolders := fmt.Sprintf("find '%s' -maxdepth 1 -mindepth 1 -type d -printf '%%f\\n'", remotePath)
-	folderOutput, err := command.ExecuteCommand(client, cmdFolders)
+	folderOutput, err := command.Output(r.Context(), client,
+		"find", remotePath, "-maxdepth", "1", "-mindepth", "1", "-type", "d", "-printf", "%f\\n")
 	if err != nil {
 		logger.Err("Failed to list folders (%s): %v", remotePath, err)
-		http.Error(w, "Failed to list folders", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list folders")
 		return
 	}
 
 	// ファイルを取得
-	cmdFiles := fmt.Sprintf("find '%s' -maxdepth 1 -mindepth 1 -type f -printf '%%f\\n'", remotePath)
-	fileOutput, err := command.ExecuteCommand(client, cmdFiles)
+	fileOutput, err := command.Output(r.Context(), client,
+		"find", remotePath, "-maxdepth", "1", "-mindepth", "1", "-type", "f", "-printf", "%f\\n")
 	if err != nil {
 		logger.Err("Failed to list files (%s): %v", remotePath, err)
-		http.Error(w, "Failed to list files", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list files")
 		return
 	}
 
@@ -157,8 +92,6 @@ func driveAPIHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.TrimSpace(folderOutput) != "" {
 		for _, line := range strings.Split(strings.TrimSpace(folderOutput), "\n") {
 			if line != "" {
-				relPath := strings.TrimPrefix(remotePath, homeDir)
-				relPath = strings.TrimPrefix(relPath, "/")
 				folders = append(folders, DriveItem{
 					Name: line,
 					Path: path.Join(relPath, line),
@@ -171,8 +104,6 @@ func driveAPIHandler(w http.ResponseWriter, r *http.Request) {
 	if strings.TrimSpace(fileOutput) != "" {
 		for _, line := range strings.Split(strings.TrimSpace(fileOutput), "\n") {
 			if line != "" {
-				relPath := strings.TrimPrefix(remotePath, homeDir)
-				relPath = strings.TrimPrefix(relPath, "/")
 				files = append(files, DriveItem{
 					Name: line,
 					Path: path.Join(relPath, line),
@@ -198,61 +129,35 @@ func driveAPIHandler(w http.ResponseWriter, r *http.Request) {
 		Files:   files,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, response)
 }
 
 func drivePreviewHandler(w http.ResponseWriter, r *http.Request) {
 	file := r.URL.Query().Get("file")
 	if file == "" {
-		http.Error(w, "File not specified", http.StatusBadRequest)
-		return
-	}
-
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
 		return
 	}
 
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Error(w, "Invalid session", http.StatusBadRequest)
-		return
-	}
+	client := authFromContext(r).Client
 
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
-		return
-	}
-
-	homeDir, err := command.ExecuteCommand(client, "echo $HOME")
-	if err != nil {
-		logger.Err("Failed to get home directory: %v", err)
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	_, absPath, ok := requestPath(w, r, file)
+	if !ok {
 		return
 	}
-	homeDir = strings.TrimSpace(homeDir)
-	absPath := path.Join(homeDir, file)
 
 	// MIMEタイプ取得
-	ftypeCmd := fmt.Sprintf("file -b --mime-type '%s'", absPath)
-	mimeOut, err := command.ExecuteCommand(client, ftypeCmd)
+	mimeOut, err := command.Output(r.Context(), client, "file", "-b", "--mime-type", "--", absPath)
 	if err != nil {
 		logger.Err("Failed to get mime type: %v", err)
-		http.Error(w, "Failed to determine file type", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to determine file type")
 		return
 	}
 
 	mimeType := strings.TrimSpace(mimeOut)
 
 	// JSONでMIMEタイプを返す
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, map[string]string{
 		"mime": mimeType,
 	})
 }
@@ -260,72 +165,257 @@ func drivePreviewHandler(w http.ResponseWriter, r *http.Request) {
 func driveDownloadHandler(w http.ResponseWriter, r *http.Request) {
 	file := r.URL.Query().Get("file")
 	if file == "" {
-		http.Error(w, "File not specified", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
 		return
 	}
 
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+	client := authFromContext(r).Client
+
+	_, absPath, ok := requestPath(w, r, file)
+	if !ok {
 		return
 	}
 
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Error(w, "Invalid session", http.StatusBadRequest)
+	// サイズと更新日時から Content-Length と ETag を決めて再開可能にする
+	st, err := statRemote(r.Context(), client, absPath)
+	if err != nil || !strings.HasPrefix(st.Type, "regular") {
+		writeJSONError(w, http.StatusNotFound, "File not found")
 		return
 	}
 
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
-		return
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(absPath)}))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if err := serveRemoteRange(w, r, client, absPath, st, 0); err != nil {
+		logger.Err("Failed to copy file data to response: %v", err)
 	}
+}
 
-	homeDir, err := command.ExecuteCommand(client, "echo $HOME")
-	if err != nil {
-		logger.Err("Failed to get home dir: %v", err)
-		http.Error(w, "Failed home dir", http.StatusInternalServerError)
+// driveRawHandler serves a file inline with its MIME type for previews.
+// Range requests are supported so that video and audio can seek.
+func driveRawHandler(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
+		return
+	}
+	client := authFromContext(r).Client
+	_, absPath, ok := requestPath(w, r, file)
+	if !ok {
 		return
 	}
-	homeDir = strings.TrimSpace(homeDir)
-	absPath := path.Join(homeDir, file)
 
-	cmd := fmt.Sprintf("cat '%s'", absPath)
-	session, err := client.NewSession()
-	if err != nil {
-		logger.Err("Failed to create session for download: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+	st, err := statRemote(r.Context(), client, absPath)
+	if err != nil || !strings.HasPrefix(st.Type, "regular") {
+		writeJSONError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if r.Header.Get("Range") == "" && st.Size > conf.Drive.MaxPreviewSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "File is too large to preview; download it instead")
 		return
 	}
-	defer session.Close()
 
-	stdout, err := session.StdoutPipe()
-	if err != nil {
-		logger.Err("Failed to get stdout pipe: %v", err)
-		http.Error(w, "Pipe error", http.StatusInternalServerError)
+	ctype := contentType(r.Context(), client, absPath)
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	if activeContentTypes[mediaType] {
+		// HTML や SVG 内のスクリプトを tune のオリジンで実行させない
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": path.Base(absPath)}))
+
+	if err := serveRemoteRange(w, r, client, absPath, st, conf.Drive.MaxPreviewSize); err != nil {
+		logger.Warn("Preview of %s interrupted: %v", absPath, err)
+	}
+}
+
+// TextChunk is a part of a text file decoded to UTF-8
+type TextChunk struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Encoding string `json:"encoding"`
+	Offset   int64  `json:"offset"`
+	Next     int64  `json:"next"`
+	Size     int64  `json:"size"`
+	EOF      bool   `json:"eof"`
+	Content  string `json:"content"`
+}
+
+const (
+	textChunkSize    = 256 << 10
+	minTextChunkSize = 4 << 10
+	maxTextChunkSize = 1 << 20
+)
+
+// ハイライト用の言語名 (highlight.js などのクラス名と同じ)
+var textLanguages = map[string]string{
+	".go": "go", ".js": "javascript", ".mjs": "javascript", ".ts": "typescript",
+	".py": "python", ".rb": "ruby", ".java": "java", ".kt": "kotlin", ".scala": "scala",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".cc": "cpp", ".hpp": "cpp", ".cs": "csharp",
+	".rs": "rust", ".php": "php", ".swift": "swift", ".lua": "lua", ".pl": "perl",
+	".sh": "bash", ".bash": "bash", ".zsh": "bash",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "ini", ".ini": "ini", ".conf": "ini",
+	".xml": "xml", ".html": "xml", ".htm": "xml", ".svg": "xml",
+	".css": "css", ".scss": "scss", ".md": "markdown", ".sql": "sql",
+}
+
+var textLanguageNames = map[string]string{
+	"Dockerfile": "dockerfile",
+	"Makefile":   "makefile",
+}
+
+func textLanguage(name string) string {
+	if lang, ok := textLanguageNames[name]; ok {
+		return lang
+	}
+	if lang, ok := textLanguages[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	return "plaintext"
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of b
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// trimPartialUTF16 returns the length of the UTF-16 data in b that ends on
+// a whole character: an odd byte or a lone high surrogate at the end is
+// left for the next chunk
+func trimPartialUTF16(b []byte, encoding string) int {
+	n := len(b) &^ 1
+	if n >= 2 {
+		u := binary.LittleEndian.Uint16(b[n-2:])
+		if encoding == textenc.UTF16BE {
+			u = binary.BigEndian.Uint16(b[n-2:])
+		}
+		if utf16.IsSurrogate(rune(u)) && u < 0xDC00 {
+			n -= 2
+		}
+	}
+	return n
+}
+
+// alignTextChunk keeps a chunk on whole UTF-16 code units: the offset is
+// rounded down and the limit to an even number of bytes
+func alignTextChunk(offset, limit int64, encoding string) (int64, int64) {
+	if encoding == textenc.UTF16LE || encoding == textenc.UTF16BE {
+		offset &^= 1
+	}
+	return offset, max(limit&^1, 2)
+}
+
+// decodeChunk decodes a chunk of a text file and returns the number of
+// bytes consumed. encoding is the one found in the first chunk, or "" for
+// the first chunk itself; only the first chunk carries the byte order mark
+// of UTF-16, so later ones must be decoded with it. Unless it is the last
+// chunk, an incomplete UTF-8 or UTF-16 character at the end is left for
+// the next chunk. At least one byte is consumed from a non-empty chunk.
+func decodeChunk(data []byte, eof bool, encoding string) (content, enc string, n int, err error) {
+	if encoding == "" {
+		encoding = textenc.DetectBOM(data)
+	}
+	switch encoding {
+	case textenc.UTF16LE, textenc.UTF16BE:
+		n = len(data)
+		if m := trimPartialUTF16(data, encoding); !eof && m > 0 {
+			n = m
+		}
+		content, err = textenc.DecodeAs(data[:n], encoding)
+		return content, encoding, n, err
+	case textenc.Latin1:
+		content, err = textenc.DecodeAs(data, encoding)
+		return content, encoding, len(data), err
+	}
+
+	if !eof {
+		if trimmed := trimPartialRune(data); len(trimmed) > 0 && len(trimmed) < len(data) {
+			content, enc, err := textenc.Decode(trimmed)
+			if err == nil && (enc == textenc.UTF8 || enc == textenc.UTF8BOM) {
+				return content, enc, len(trimmed), nil
+			}
+		}
+	}
+	content, enc, err = textenc.Decode(data)
+	return content, enc, len(data), err
+}
+
+// driveTextHandler returns a chunk of a text file for the code viewer.
+// Query: file, offset (bytes), limit (bytes), encoding (of the first chunk)
+func driveTextHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	file := q.Get("file")
+	if file == "" {
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
+		return
+	}
+	client := authFromContext(r).Client
+	root, absPath, ok := requestPath(w, r, file)
+	if !ok {
 		return
 	}
 
-	if err := session.Start(cmd); err != nil {
-		logger.Err("Failed to start cat command: %v", err)
-		http.Error(w, "Failed to start file read", http.StatusInternalServerError)
+	offset, _ := strconv.ParseInt(q.Get("offset"), 10, 64)
+	limit, _ := strconv.ParseInt(q.Get("limit"), 10, 64)
+	if limit <= 0 {
+		limit = textChunkSize
+	}
+	limit = max(minTextChunkSize, min(limit, maxTextChunkSize))
+	encoding := q.Get("encoding")
+	switch encoding {
+	case "", textenc.UTF8, textenc.UTF8BOM, textenc.UTF16LE, textenc.UTF16BE, textenc.Latin1:
+	default:
+		writeJSONError(w, http.StatusBadRequest, "Unsupported encoding")
 		return
 	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", path.Base(absPath)))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	st, err := statRemote(r.Context(), client, absPath)
+	if err != nil || !strings.HasPrefix(st.Type, "regular") {
+		writeJSONError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	offset = max(0, min(offset, st.Size))
+	offset, limit = alignTextChunk(offset, limit, encoding)
 
-	if _, err := io.Copy(w, stdout); err != nil {
-		logger.Err("Failed to copy file data to response: %v", err)
+	rc, err := openRemote(client, absPath, offset, limit)
+	if err != nil {
+		logger.Err("Failed to read %s: %v", absPath, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		logger.Err("Failed to read %s: %v", absPath, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read file")
 		return
 	}
 
-	if err := session.Wait(); err != nil {
-		logger.Err("Session wait error: %v", err)
+	// 読み込み中にファイルが短くなった場合も先へ進めないので終わりとする
+	eof := len(data) == 0 || offset+int64(len(data)) >= st.Size
+	content, encoding, n, err := decodeChunk(data, eof, encoding)
+	if err != nil {
+		writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
 	}
+
+	writeJSON(w, TextChunk{
+		Path:     relativePath(root, absPath),
+		Language: textLanguage(path.Base(absPath)),
+		Encoding: encoding,
+		Offset:   offset,
+		Next:     offset + int64(n),
+		Size:     st.Size,
+		EOF:      eof,
+		Content:  content,
+	})
 }
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/tune/internal/textenc"
+)
+
+func TestTrimPartialRune(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"aé", "aé"},
+		{"a\xc3", "a"},
+		{"日本", "日本"},
+		{"日\xe6\x9c", "日"},
+		{"日\xe6", "日"},
+		{"a\xf0\x9f\x98", "a"},
+		{"a😀", "a😀"},
+		// 継続バイトだけが並ぶ不正な列はそのまま返す
+		{"a\x80\x80\x80\x80", "a\x80\x80\x80\x80"},
+		{"\xc3", ""},
+	}
+	for _, tt := range tests {
+		if got := string(trimPartialRune([]byte(tt.in))); got != tt.want {
+			t.Errorf("trimPartialRune(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeChunk(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		eof      bool
+		content  string
+		encoding string
+		n        int
+	}{
+		{"complete utf-8", "abc", false, "abc", textenc.UTF8, 3},
+		{"split utf-8", "a日\xe6\x9c", false, "a日", textenc.UTF8, 4},
+		{"split at eof", "a\xc3", true, "aÃ", textenc.Latin1, 2},
+		{"latin-1 is not trimmed", "caf\xe9 \xe9", false, "café é", textenc.Latin1, 6},
+		{"only a partial rune", "\xe6\x9c", false, "æ\u009c", textenc.Latin1, 2},
+		{"empty", "", true, "", textenc.UTF8, 0},
+		{"utf-16 is not trimmed", "\xff\xfea\x00\xe5\x65", false, "a日", textenc.UTF16LE, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, encoding, n, err := decodeChunk([]byte(tt.data), tt.eof, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content != tt.content || encoding != tt.encoding || n != tt.n {
+				t.Errorf("decodeChunk(%q) = %q, %s, %d; want %q, %s, %d", tt.data, content, encoding, n, tt.content, tt.encoding, tt.n)
+			}
+			if len(tt.data) > 0 && n == 0 {
+				t.Error("no progress on a non-empty chunk")
+			}
+		})
+	}
+}
+
+// 2 つ以上のチャンクに分けて読んだ UTF-16 のファイルが元の文字列に戻ること
+func TestDecodeChunkUTF16(t *testing.T) {
+	text := "ab日本😀c\n" + strings.Repeat("x", 5) + "😀"
+	tests := []struct {
+		name     string
+		encoding string
+		limit    int64
+	}{
+		{"le split after bom", textenc.UTF16LE, 4},
+		{"le odd limit", textenc.UTF16LE, 7},
+		{"le split surrogate", textenc.UTF16LE, 12},
+		{"be odd limit", textenc.UTF16BE, 5},
+		{"be split surrogate", textenc.UTF16BE, 12},
+		{"le one chunk", textenc.UTF16LE, 1 << 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := textenc.Encode(text, tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := int64(len(file))
+			var got strings.Builder
+			offset, encoding, chunks := int64(0), "", 0
+			for {
+				// driveTextHandler と同じ手順で読む
+				off, limit := alignTextChunk(offset, tt.limit, encoding)
+				data := file[off:min(off+limit, size)]
+				eof := len(data) == 0 || off+int64(len(data)) >= size
+				content, enc, n, err := decodeChunk(data, eof, encoding)
+				if err != nil {
+					t.Fatalf("chunk at %d: %v", off, err)
+				}
+				if enc != tt.encoding {
+					t.Fatalf("chunk at %d decoded as %s", off, enc)
+				}
+				got.WriteString(content)
+				chunks++
+				if eof {
+					break
+				}
+				if n == 0 {
+					t.Fatalf("no progress at %d", off)
+				}
+				offset, encoding = off+int64(n), enc
+			}
+			if got.String() != text {
+				t.Errorf("got %q in %d chunks, want %q", got.String(), chunks, text)
+			}
+			if tt.limit < size && chunks < 2 {
+				t.Errorf("read in %d chunk", chunks)
+			}
+		})
+	}
+}
+
+func TestAlignTextChunk(t *testing.T) {
+	tests := []struct {
+		offset, limit int64
+		encoding      string
+		wantOff       int64
+		wantLimit     int64
+	}{
+		{0, 4096, "", 0, 4096},
+		{0, 4097, "", 0, 4096},
+		{7, 4096, textenc.UTF8, 7, 4096},
+		{7, 4097, textenc.UTF16LE, 6, 4096},
+		{8, 4096, textenc.UTF16BE, 8, 4096},
+	}
+	for _, tt := range tests {
+		off, limit := alignTextChunk(tt.offset, tt.limit, tt.encoding)
+		if off != tt.wantOff || limit != tt.wantLimit {
+			t.Errorf("alignTextChunk(%d, %d, %q) = %d, %d; want %d, %d", tt.offset, tt.limit, tt.encoding, off, limit, tt.wantOff, tt.wantLimit)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"golang.org/x/crypto/ssh"
+)
+
+// errInvalidRange means the Range header cannot be satisfied
+var errInvalidRange = errors.New("invalid range")
+
+// スクリプトを実行できる形式はサンドボックス化して返す
+var activeContentTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// remoteReader streams a remote file through an SSH session
+type remoteReader struct {
+	io.Reader
+	session *ssh.Session
+}
+
+func (rr *remoteReader) Close() error {
+	return rr.session.Close()
+}
+
+// openRemote starts reading length bytes of abs from offset.
+// A negative length reads to the end of the file.
+func openRemote(client *ssh.Client, abs string, offset, length int64) (io.ReadCloser, error) {
+	cmd := command.Join("cat", "--", abs)
+	if offset > 0 {
+		cmd = command.Join("tail", "-c", "+"+strconv.FormatInt(offset+1, 10), "--", abs)
+	}
+	if length >= 0 {
+		cmd += " | " + command.Join("head", "-c", strconv.FormatInt(length, 10))
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(cmd); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &remoteReader{Reader: stdout, session: session}, nil
+}
+
+// contentType returns the MIME type of a remote file, preferring the
+// extension and falling back to file(1) for unknown extensions
+func contentType(ctx context.Context, client *ssh.Client, abs string) string {
+	if t := mime.TypeByExtension(path.Ext(abs)); t != "" {
+		return t
+	}
+	out, err := command.Output(ctx, client, "file", "-b", "--mime-type", "--", abs)
+	if err != nil || out == "" {
+		return "application/octet-stream"
+	}
+	if strings.HasPrefix(out, "text/") {
+		return out + "; charset=utf-8"
+	}
+	return out
+}
+
+// parseRange parses a single "bytes=start-end" range for a file of size.
+// Multiple ranges are not supported.
+func parseRange(header string, size int64) (start, end int64, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, errInvalidRange
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errInvalidRange
+	}
+	if first == "" {
+		// bytes=-N は末尾 N バイト
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, errInvalidRange
+		}
+		return max(size-n, 0), size - 1, nil
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, errInvalidRange
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, errInvalidRange
+		}
+		end = min(end, size-1)
+	}
+	return start, end, nil
+}
+
+// remoteETag identifies a version of a remote file by its mtime and size
+func remoteETag(st *remoteStat) string {
+	return fmt.Sprintf(`"%x-%x"`, st.Mtime, st.Size)
+}
+
+// notModified reports whether the client's cached copy is still current
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		return !modTime.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// rangeAllowed checks If-Range so that a resumed download whose file has
+// changed in the meantime gets the whole new file instead of a mixed one
+func rangeAllowed(r *http.Request, etag string, modTime time.Time) bool {
+	cond := r.Header.Get("If-Range")
+	if cond == "" {
+		return true
+	}
+	if strings.HasPrefix(cond, `"`) {
+		return cond == etag
+	}
+	t, err := http.ParseTime(cond)
+	return err == nil && t.Equal(modTime.Truncate(time.Second))
+}
+
+// serveRemoteRange writes abs with Range support. A single range is
+// answered with 206; maxChunk > 0 shortens ranges to at most that many
+// bytes, which clients such as media players handle by asking again.
+// ETag and Last-Modified are set from st so that clients can revalidate
+// and resume. The response is always written; a returned error is only
+// for logging.
+func serveRemoteRange(w http.ResponseWriter, r *http.Request, client *ssh.Client, abs string, st *remoteStat, maxChunk int64) error {
+	size := st.Size
+	etag := remoteETag(st)
+	modTime := time.Unix(st.Mtime, 0).UTC()
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && notModified(r, etag, modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	start, length := int64(0), size
+	status := http.StatusOK
+	if header := r.Header.Get("Range"); header != "" && size > 0 && rangeAllowed(r, etag, modTime) {
+		s, e, err := parseRange(header, size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+			return nil
+		}
+		start, length = s, e-s+1
+		if maxChunk > 0 {
+			length = min(length, maxChunk)
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	rc, err := openRemote(client, abs, start, length)
+	if err != nil {
+		w.Header().Del("Content-Length")
+		w.Header().Del("Content-Range")
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read file")
+		return err
+	}
+	defer rc.Close()
+
+	w.WriteHeader(status)
+	_, err = io.CopyN(w, rc, length)
+	return err
+}
@@ -0,0 +1,40 @@
+package server
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		size       int64
+		start, end int64
+		wantErr    bool
+	}{
+		{"bytes=0-99", 1000, 0, 99, false},
+		{"bytes=100-", 1000, 100, 999, false},
+		{"bytes=900-2000", 1000, 900, 999, false},
+		{"bytes=-100", 1000, 900, 999, false},
+		{"bytes=-5000", 1000, 0, 999, false},
+		{"bytes= 5-9", 1000, 5, 9, false},
+		{"bytes=999-999", 1000, 999, 999, false},
+		{"bytes=1000-", 1000, 0, 0, true},
+		{"bytes=50-10", 1000, 0, 0, true},
+		{"bytes=-0", 1000, 0, 0, true},
+		{"bytes=-10", 0, 0, 0, true},
+		{"bytes=0-", 0, 0, 0, true},
+		{"bytes=0-1,5-6", 1000, 0, 0, true},
+		{"bytes=a-b", 1000, 0, 0, true},
+		{"bytes=5", 1000, 0, 0, true},
+		{"items=0-1", 1000, 0, 0, true},
+		{"", 1000, 0, 0, true},
+	}
+	for _, tt := range tests {
+		start, end, err := parseRange(tt.header, tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRange(%q, %d) error = %v, wantErr %v", tt.header, tt.size, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (start != tt.start || end != tt.end) {
+			t.Errorf("parseRange(%q, %d) = %d-%d, want %d-%d", tt.header, tt.size, start, end, tt.start, tt.end)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+var errOutsideRoot = errors.New("path is outside of the drive root")
+
+// driveRoot returns the absolute directory the drive and uploader are
+// confined to for the session. It is resolved once and cached.
+func driveRoot(ctx context.Context, auth *AuthContext) (string, error) {
+	if root, ok := sshManager.GetRoot(auth.SessionID); ok {
+		return root, nil
+	}
+
+	root := conf.Profile(auth.Host).Root
+	if root == "" || root == "~" || strings.HasPrefix(root, "~/") {
+		home, err := command.Output(ctx, auth.Client, "printenv", "HOME")
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %v", err)
+		}
+		root = path.Join(home, strings.TrimPrefix(root, "~"))
+	}
+	if !path.IsAbs(root) {
+		return "", fmt.Errorf("drive root for %s must be absolute or start with ~: %s", auth.Host, root)
+	}
+
+	// シンボリックリンクを解決した実体パスを基点にする
+	real, err := command.Output(ctx, auth.Client, "readlink", "-m", "--", root)
+	if err != nil {
+		return "", err
+	}
+	root = path.Clean(real)
+
+	sshManager.SetRoot(auth.SessionID, root)
+	logger.Debug("Drive root for %s -> %s", auth.UserHost(), root)
+	return root, nil
+}
+
+// resolvePath maps a path sent by the browser to an absolute remote path.
+// Relative paths are taken from root, absolute paths must already lie inside it.
+// Symlinks are resolved on the remote host so they cannot lead out of the root.
+func resolvePath(ctx context.Context, client *ssh.Client, root, p string) (string, error) {
+	var abs string
+	if path.IsAbs(p) {
+		abs = path.Clean(p)
+	} else {
+		abs = path.Join(root, p)
+	}
+	if !isWithin(root, abs) {
+		return "", errOutsideRoot
+	}
+
+	real, err := command.Output(ctx, client, "readlink", "-m", "--", abs)
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(root, path.Clean(real)) {
+		return "", errOutsideRoot
+	}
+	return abs, nil
+}
+
+// isWithin reports whether p is root or below it
+func isWithin(root, p string) bool {
+	if root == "/" {
+		return path.IsAbs(p)
+	}
+	return p == root || strings.HasPrefix(p, root+"/")
+}
+
+// relativePath converts an absolute path under root to the form used by the browser
+func relativePath(root, abs string) string {
+	if root == "/" {
+		return strings.TrimPrefix(abs, "/")
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(abs, root), "/")
+}
+
+// requestPath resolves p for the authenticated request, writing a JSON
+// error and returning false if it is outside the root or cannot be resolved.
+func requestPath(w http.ResponseWriter, r *http.Request, p string) (root, abs string, ok bool) {
+	auth := authFromContext(r)
+	root, err := driveRoot(r.Context(), auth)
+	if err != nil {
+		logger.Err("Failed to resolve drive root: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to resolve drive root")
+		return "", "", false
+	}
+	abs, err = resolvePath(r.Context(), auth.Client, root, p)
+	if err != nil {
+		if errors.Is(err, errOutsideRoot) {
+			logger.Warn("Rejected path outside of drive root (%s): %q", auth.UserHost(), p)
+			writeJSONError(w, http.StatusForbidden, "Path is outside of the drive root")
+		} else {
+			logger.Err("Failed to resolve path %q: %v", p, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to resolve path")
+		}
+		return "", "", false
+	}
+	return root, abs, true
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		root, p string
+		want    bool
+	}{
+		{"/home/u", "/home/u", true},
+		{"/home/u", "/home/u/a/b", true},
+		{"/home/u", "/home/user", false},
+		{"/home/u", "/home", false},
+		{"/home/u", "/etc/passwd", false},
+		{"/", "/etc", true},
+		{"/", "etc", false},
+	}
+	for _, tt := range tests {
+		if got := isWithin(tt.root, tt.p); got != tt.want {
+			t.Errorf("isWithin(%q, %q) = %v, want %v", tt.root, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		root, abs, want string
+	}{
+		{"/home/u", "/home/u", ""},
+		{"/home/u", "/home/u/docs/a.txt", "docs/a.txt"},
+		{"/", "/etc/hosts", "etc/hosts"},
+	}
+	for _, tt := range tests {
+		if got := relativePath(tt.root, tt.abs); got != tt.want {
+			t.Errorf("relativePath(%q, %q) = %q, want %q", tt.root, tt.abs, got, tt.want)
+		}
+	}
+}
+
+// パスの字面だけでルート外と判定できるものはリモートに問い合わせずに拒否される
+func TestResolvePathRejectsOutsideRoot(t *testing.T) {
+	for _, p := range []string{
+		"..",
+		"../other",
+		"docs/../../other",
+		"/etc/passwd",
+		"/home/user2",
+		"/home/u/../../etc",
+	} {
+		if _, err := resolvePath(context.Background(), nil, "/home/u", p); !errors.Is(err, errOutsideRoot) {
+			t.Errorf("resolvePath(%q) error = %v, want errOutsideRoot", p, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"github.com/rxxuzi/tune/internal/textenc"
+	"golang.org/x/crypto/ssh"
+)
+
+// EditorFile is a text file opened in the editor
+type EditorFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	Size     int64  `json:"size"`
+	Mtime    int64  `json:"mtime"`
+	Hash     string `json:"hash"`
+}
+
+// remoteStat is the result of stat on the remote host
+type remoteStat struct {
+	Size  int64
+	Mtime int64
+	Type  string
+}
+
+// 一時ファイルに書き込み、元のファイルの権限と所有者を引き継いでから置き換える。
+// シンボリックリンクはリンク先を置き換え、リンク自体は残す。
+// 所有者の変更は root 以外では失敗することがあるため無視する。
+const atomicWriteScript = `set -e
+target=$(readlink -f -- "$1")
+tmp=$(mktemp "$(dirname "$target")/.tune-edit.XXXXXX")
+trap 'rm -f "$tmp"' EXIT
+cat > "$tmp"
+chmod --reference="$target" "$tmp"
+chown --reference="$target" "$tmp" 2>/dev/null || true
+mv -f "$tmp" "$target"`
+
+func RegisterEditorHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/edit", requireAuth(editorPageHandler))
+	mux.HandleFunc("/api/drive/file", requireAuth(editorFileHandler))
+}
+
+func editorPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/edit accessed")
+	file := r.URL.Query().Get("file")
+	renderTemplate(w, r, "editor", struct {
+		UserHost string
+		File     string
+		Name     string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+		File:     file,
+		Name:     path.Base(file),
+	})
+}
+
+func editorFileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		editorReadHandler(w, r)
+	case http.MethodPost:
+		editorWriteHandler(w, r)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// statRemote returns the size, mtime and type of a remote file
+func statRemote(ctx context.Context, client *ssh.Client, abs string) (*remoteStat, error) {
+	out, err := command.Output(ctx, client, "stat", "-L", "-c", "%s %Y %F", "--", abs)
+	if err != nil {
+		return nil, err
+	}
+	f := strings.SplitN(out, " ", 3)
+	if len(f) < 3 {
+		return nil, fmt.Errorf("unexpected stat output: %q", out)
+	}
+	st := &remoteStat{Type: f[2]}
+	if st.Size, err = strconv.ParseInt(f[0], 10, 64); err != nil {
+		return nil, err
+	}
+	if st.Mtime, err = strconv.ParseInt(f[1], 10, 64); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func editorReadHandler(w http.ResponseWriter, r *http.Request) {
+	client := authFromContext(r).Client
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
+		return
+	}
+	root, abs, ok := requestPath(w, r, file)
+	if !ok {
+		return
+	}
+
+	st, err := statRemote(r.Context(), client, abs)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if st.Type != "regular file" && st.Type != "regular empty file" {
+		writeJSONError(w, http.StatusBadRequest, "Not a regular file")
+		return
+	}
+	if st.Size > conf.Drive.MaxEditSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("File is too large to edit (%d bytes, limit %d)", st.Size, conf.Drive.MaxEditSize))
+		return
+	}
+
+	res, err := command.Run(r.Context(), client, "cat", "--", abs)
+	if err != nil || res.ExitCode != 0 {
+		logger.Err("Failed to read %s: %v", abs, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+	data := []byte(res.Stdout)
+	content, encoding, err := textenc.Decode(data)
+	if err != nil {
+		writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	writeJSON(w, EditorFile{
+		Path:     relativePath(root, abs),
+		Content:  content,
+		Encoding: encoding,
+		Size:     int64(len(data)),
+		Mtime:    st.Mtime,
+		Hash:     hashBytes(data),
+	})
+}
+
+// errConflict means the file changed since the editor loaded it
+var errConflict = errors.New("file was modified by someone else")
+
+// checkConflict compares the remote file with the version the editor loaded
+func checkConflict(ctx context.Context, client *ssh.Client, abs string, size, mtime int64, hash string) error {
+	if hash == "" {
+		st, err := statRemote(ctx, client, abs)
+		if err != nil {
+			return err
+		}
+		if st.Mtime != mtime || st.Size != size {
+			return errConflict
+		}
+		return nil
+	}
+	// mtime は秒単位なので、同じ秒に同じサイズで書き換えられても気付けるよう常に内容で比較する
+	out, err := command.Output(ctx, client, "sha256sum", "--", abs)
+	if err != nil {
+		return err
+	}
+	current, _, _ := strings.Cut(out, " ")
+	if current != hash {
+		return errConflict
+	}
+	return nil
+}
+
+func editorWriteHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		File     string `json:"file"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+		// 読み込んだ時点のファイルの状態
+		BaseSize  int64  `json:"base_size"`
+		BaseMtime int64  `json:"base_mtime"`
+		BaseHash  string `json:"base_hash"`
+		Force     bool   `json:"force"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	auth := authFromContext(r)
+	root, abs, ok := requestPath(w, r, req.File)
+	if !ok {
+		return
+	}
+
+	data, err := textenc.Encode(req.Content, req.Encoding)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if int64(len(data)) > conf.Drive.MaxEditSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Content is too large")
+		return
+	}
+
+	if !req.Force {
+		err := checkConflict(r.Context(), auth.Client, abs, req.BaseSize, req.BaseMtime, req.BaseHash)
+		if errors.Is(err, errConflict) {
+			logger.Warn("Editor: conflict on %s (%s)", abs, auth.UserHost())
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Err("Editor: failed to check %s: %v", abs, err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to check the file")
+			return
+		}
+	}
+
+	res, err := command.RunInput(r.Context(), auth.Client, bytes.NewReader(data), "sh", "-c", atomicWriteScript, "sh", abs)
+	if err != nil || res.ExitCode != 0 {
+		msg := "Failed to write file"
+		if res != nil {
+			msg += ": " + strings.TrimSpace(res.Stderr)
+		}
+		logger.Err("Editor: failed to write %s: %v %s", abs, err, msg)
+		writeJSONError(w, http.StatusInternalServerError, msg)
+		return
+	}
+
+	st, err := statRemote(r.Context(), auth.Client, abs)
+	if err != nil {
+		logger.Err("Editor: failed to stat %s after writing: %v", abs, err)
+		writeJSONError(w, http.StatusInternalServerError, "File written but could not be checked")
+		return
+	}
+	logger.Info("Editor: %s saved %s (%d bytes)", auth.UserHost(), abs, len(data))
+	writeJSON(w, EditorFile{
+		Path:     relativePath(root, abs),
+		Encoding: req.Encoding,
+		Size:     int64(len(data)),
+		Mtime:    st.Mtime,
+		Hash:     hashBytes(data),
+	})
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// atomicWriteScript をローカルの sh で実行して、リンクと権限が保たれることを確かめる
+func TestAtomicWriteScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real.txt")
+	link := filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(real, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real.txt", link); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{link, real} {
+		cmd := exec.Command(sh, "-c", atomicWriteScript, "sh", target)
+		cmd.Stdin = strings.NewReader("new " + filepath.Base(target))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("write %s: %v: %s", target, err, out)
+		}
+		fi, err := os.Lstat(link)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s is no longer a symlink", link)
+		}
+		st, err := os.Stat(real)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode().Perm() != 0640 {
+			t.Errorf("mode = %o, want 640", st.Mode().Perm())
+		}
+		data, _ := os.ReadFile(real)
+		if want := "new " + filepath.Base(target); string(data) != want {
+			t.Errorf("content = %q, want %q", data, want)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+// SavedHost is a saved connection without its password
+type SavedHost struct {
+	Host string   `json:"host"`
+	User string   `json:"user"`
+	Port int      `json:"port"`
+	Tags []string `json:"tags"`
+}
+
+// FanOutResult is the outcome of a command on a single host
+type FanOutResult struct {
+	Host       string `json:"host"`
+	User       string `json:"user"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Truncated  bool   `json:"truncated,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FanOutRun is a command run on a set of hosts
+type FanOutRun struct {
+	ID      string         `json:"id"`
+	Command string         `json:"command"`
+	Started time.Time      `json:"started"`
+	Results []FanOutResult `json:"results"`
+	owner   string
+}
+
+// fanOutStart is the first line of a streamed run
+type fanOutStart struct {
+	ID      string    `json:"id"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+	Hosts   int       `json:"hosts"`
+}
+
+// fanOutEnd is the last line of a streamed run
+type fanOutEnd struct {
+	Done      bool `json:"done"`
+	Succeeded int  `json:"succeeded"`
+	Total     int  `json:"total"`
+}
+
+// 直近の実行結果 (エクスポート用) の件数と、ホストごとに保持する出力の上限
+const (
+	maxFanOutRuns   = 20
+	maxFanOutOutput = 64 * 1024
+)
+
+var (
+	fanOutMu   sync.Mutex
+	fanOutRuns []*FanOutRun
+)
+
+func RegisterFanOutHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/multi", requireAuth(fanOutPageHandler))
+	mux.HandleFunc("/api/multi/hosts", requireAuth(savedHostsHandler))
+	mux.HandleFunc("/api/multi/run", requireAuth(fanOutRunHandler))
+	mux.HandleFunc("/api/multi/export", requireAuth(fanOutExportHandler))
+}
+
+func fanOutPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/multi accessed")
+	renderTemplate(w, r, "multi", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func savedHostsHandler(w http.ResponseWriter, r *http.Request) {
+	hosts, err := loadSavedHosts()
+	if err != nil {
+		logger.Warn("Failed to load saved hosts: %v", err)
+	}
+	list := []SavedHost{}
+	for _, h := range hosts {
+		list = append(list, SavedHost{Host: h.Host, User: h.User, Port: h.Port, Tags: h.Tags})
+	}
+	writeJSON(w, list)
+}
+
+// fanOutRunHandler runs a command on the selected saved hosts and streams
+// the result of each host as NDJSON as soon as it finishes
+func fanOutRunHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Command string   `json:"command"`
+		Hosts   []string `json:"hosts"`
+		Tag     string   `json:"tag"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	auth := authFromContext(r)
+	req.Command = strings.TrimSpace(req.Command)
+	if req.Command == "" {
+		writeJSONError(w, http.StatusBadRequest, "Command is required")
+		return
+	}
+
+	saved, err := loadSavedHosts()
+	if err != nil {
+		logger.Err("Failed to load saved hosts: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load saved hosts")
+		return
+	}
+	hosts := selectHosts(saved, req.Hosts, req.Tag)
+	if len(hosts) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No hosts selected")
+		return
+	}
+
+	logger.Info("Fan-out (%s) on %d hosts: %s", auth.UserHost(), len(hosts), req.Command)
+	run := &FanOutRun{
+		ID:      uuid.New().String(),
+		Command: req.Command,
+		Started: time.Now(),
+		owner:   auth.SessionID,
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	enc.Encode(fanOutStart{ID: run.ID, Command: run.Command, Started: run.Started, Hosts: len(hosts)})
+	rc.Flush()
+
+	end := fanOutEnd{Done: true, Total: len(hosts)}
+	run.Results = runFanOut(r.Context(), hosts, req.Command, conf.FanOut.Concurrency, conf.FanOut.Timeout.Std(), maxFanOutOutput, func(res FanOutResult) {
+		if res.ExitCode == 0 && res.Error == "" {
+			end.Succeeded++
+		}
+		enc.Encode(res)
+		rc.Flush()
+	})
+
+	fanOutMu.Lock()
+	fanOutRuns = append(fanOutRuns, run)
+	if len(fanOutRuns) > maxFanOutRuns {
+		fanOutRuns = fanOutRuns[len(fanOutRuns)-maxFanOutRuns:]
+	}
+	fanOutMu.Unlock()
+
+	enc.Encode(end)
+}
+
+func fanOutExportHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	id := r.URL.Query().Get("id")
+
+	var run *FanOutRun
+	fanOutMu.Lock()
+	for _, fr := range fanOutRuns {
+		if fr.ID == id && fr.owner == auth.SessionID {
+			run = fr
+		}
+	}
+	fanOutMu.Unlock()
+	if run == nil {
+		writeJSONError(w, http.StatusNotFound, "Run not found")
+		return
+	}
+
+	name := "tune-" + run.Started.Format("20060102-150405")
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.csv\"", name))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"host", "user", "exit_code", "duration_ms", "error", "stdout", "stderr"})
+		for _, res := range run.Results {
+			cw.Write([]string{
+				res.Host,
+				res.User,
+				strconv.Itoa(res.ExitCode),
+				strconv.FormatInt(res.DurationMs, 10),
+				res.Error,
+				res.Stdout,
+				res.Stderr,
+			})
+		}
+		cw.Flush()
+	default:
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", name))
+		writeJSON(w, run)
+	}
+}
+
+// selectHosts returns the saved hosts that are named or carry the tag
+func selectHosts(saved []SSHInfo, names []string, tag string) []SSHInfo {
+	var hosts []SSHInfo
+	for _, h := range saved {
+		if slices.Contains(names, h.Host) || (tag != "" && slices.Contains(h.Tags, tag)) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// runFanOut runs cmd on every host, connecting to at most concurrency hosts
+// at a time. emit is called with each result as it completes; calls are
+// serialized. The returned results are in the order of hosts. At most limit
+// bytes of stdout and stderr are kept per host.
+func runFanOut(ctx context.Context, hosts []SSHInfo, cmd string, concurrency int, timeout time.Duration, limit int, emit func(FanOutResult)) []FanOutResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]FanOutResult, len(hosts))
+	sem := make(chan struct{}, concurrency)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for i := range hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			res := runOnSavedHost(ctx, &hosts[i], cmd, timeout, limit)
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = res
+			emit(res)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// runOnSavedHost connects to a saved host, runs cmd through its shell and
+// disconnects. Output beyond limit bytes per stream is discarded.
+func runOnSavedHost(ctx context.Context, info *SSHInfo, cmd string, timeout time.Duration, limit int) FanOutResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	res := FanOutResult{Host: info.Host, User: info.User, ExitCode: -1}
+
+	client, err := dialHost(info)
+	if err != nil {
+		logger.Warn("Fan-out: connection to %s failed: %v", info.Host, err)
+		res.Error = err.Error()
+		res.DurationMs = time.Since(start).Milliseconds()
+		return res
+	}
+	defer client.Close()
+
+	out, err := command.RunShellLimit(ctx, client, cmd, limit)
+	if err != nil {
+		res.Error = err.Error()
+		res.DurationMs = time.Since(start).Milliseconds()
+		return res
+	}
+	res.ExitCode = out.ExitCode
+	res.Stdout = out.Stdout
+	res.Stderr = out.Stderr
+	res.Truncated = out.Truncated
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
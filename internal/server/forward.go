@@ -0,0 +1,445 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// 転送の種類
+const (
+	ForwardLocal   = "local"   // tune で待ち受けてリモート側へ接続
+	ForwardRemote  = "remote"  // リモートで待ち受けて tune 側へ接続
+	ForwardDynamic = "dynamic" // tune で SOCKS5 プロキシとして待ち受け
+)
+
+// Tunnel is an active port forward belonging to a login session
+type Tunnel struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Listen    string    `json:"listen"`
+	Target    string    `json:"target,omitempty"`
+	Created   time.Time `json:"created"`
+	BytesIn   int64     `json:"bytes_in"`
+	BytesOut  int64     `json:"bytes_out"`
+	Active    int64     `json:"active_conns"`
+	Total     int64     `json:"total_conns"`
+	sessionID string
+	listener  net.Listener
+	conns     map[net.Conn]struct{}
+	mu        sync.Mutex
+}
+
+// snapshot returns a copy of the tunnel that is safe to encode
+func (t *Tunnel) snapshot() Tunnel {
+	return Tunnel{
+		ID:       t.ID,
+		Kind:     t.Kind,
+		Listen:   t.Listen,
+		Target:   t.Target,
+		Created:  t.Created,
+		BytesIn:  atomic.LoadInt64(&t.BytesIn),
+		BytesOut: atomic.LoadInt64(&t.BytesOut),
+		Active:   atomic.LoadInt64(&t.Active),
+		Total:    atomic.LoadInt64(&t.Total),
+	}
+}
+
+func (t *Tunnel) track(c net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		// 既に閉じられている
+		return false
+	}
+	t.conns[c] = struct{}{}
+	return true
+}
+
+func (t *Tunnel) untrack(c net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, c)
+}
+
+// Close stops listening and drops every connection of the tunnel
+func (t *Tunnel) Close() {
+	t.listener.Close()
+	t.mu.Lock()
+	conns := t.conns
+	t.conns = nil
+	t.mu.Unlock()
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// ForwardManager holds the tunnels of all sessions
+type ForwardManager struct {
+	mu      sync.Mutex
+	tunnels map[string]*Tunnel
+}
+
+var forwards = &ForwardManager{tunnels: make(map[string]*Tunnel)}
+
+// List returns the tunnels of a session
+func (fm *ForwardManager) List(sessionID string) []Tunnel {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	list := []Tunnel{}
+	for _, t := range fm.tunnels {
+		if t.sessionID == sessionID {
+			list = append(list, t.snapshot())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+// Open starts a tunnel over client. For local and dynamic forwards listen is
+// an address on this machine; for remote forwards it is on the SSH host.
+func (fm *ForwardManager) Open(sessionID string, client *ssh.Client, kind, listen, target string) (*Tunnel, error) {
+	var ln net.Listener
+	var err error
+	switch kind {
+	case ForwardLocal, ForwardDynamic:
+		if err := checkBindAddress(listen); err != nil {
+			return nil, err
+		}
+		ln, err = net.Listen("tcp", listen)
+	case ForwardRemote:
+		ln, err = client.Listen("tcp", listen)
+	default:
+		return nil, fmt.Errorf("unknown forward type: %s", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tunnel{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Listen:    ln.Addr().String(),
+		Target:    target,
+		Created:   time.Now(),
+		sessionID: sessionID,
+		listener:  ln,
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	var dial func(net.Conn) (net.Conn, error)
+	switch kind {
+	case ForwardLocal:
+		dial = func(net.Conn) (net.Conn, error) { return client.Dial("tcp", target) }
+	case ForwardRemote:
+		dial = func(net.Conn) (net.Conn, error) { return net.DialTimeout("tcp", target, 10*time.Second) }
+	case ForwardDynamic:
+		t.Target = ""
+		dial = func(c net.Conn) (net.Conn, error) { return socks5Connect(c, client) }
+	}
+
+	fm.mu.Lock()
+	fm.tunnels[t.ID] = t
+	fm.mu.Unlock()
+
+	go fm.serve(t, dial)
+	logger.Info("Forward opened: %s %s -> %s", kind, t.Listen, target)
+	return t, nil
+}
+
+func (fm *ForwardManager) serve(t *Tunnel, dial func(net.Conn) (net.Conn, error)) {
+	for {
+		c, err := t.listener.Accept()
+		if err != nil {
+			// Close された場合も含む
+			fm.remove(t.ID)
+			return
+		}
+		if !t.track(c) {
+			c.Close()
+			return
+		}
+		atomic.AddInt64(&t.Total, 1)
+		atomic.AddInt64(&t.Active, 1)
+		go func() {
+			defer func() {
+				c.Close()
+				t.untrack(c)
+				atomic.AddInt64(&t.Active, -1)
+			}()
+			remote, err := dial(c)
+			if err != nil {
+				logger.Warn("Forward %s: dial failed: %v", t.Listen, err)
+				return
+			}
+			defer remote.Close()
+			if !t.track(remote) {
+				return
+			}
+			defer t.untrack(remote)
+			pipe(c, remote, &t.BytesOut, &t.BytesIn)
+		}()
+	}
+}
+
+// pipe copies in both directions until either side closes.
+// up counts bytes from a to b and down counts bytes from b to a.
+func pipe(a, b net.Conn, up, down *int64) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn, n *int64) {
+		io.Copy(&countingWriter{w: dst, n: n}, src)
+		// 片方向が終わったら両方閉じる
+		dst.Close()
+		src.Close()
+		done <- struct{}{}
+	}
+	go cp(b, a, up)
+	go cp(a, b, down)
+	<-done
+	<-done
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	atomic.AddInt64(cw.n, int64(n))
+	return n, err
+}
+
+func (fm *ForwardManager) remove(id string) {
+	fm.mu.Lock()
+	t, ok := fm.tunnels[id]
+	delete(fm.tunnels, id)
+	fm.mu.Unlock()
+	if ok {
+		t.Close()
+		logger.Info("Forward closed: %s %s", t.Kind, t.Listen)
+	}
+}
+
+// Close closes a tunnel of the session
+func (fm *ForwardManager) Close(sessionID, id string) bool {
+	fm.mu.Lock()
+	t, ok := fm.tunnels[id]
+	fm.mu.Unlock()
+	if !ok || t.sessionID != sessionID {
+		return false
+	}
+	fm.remove(id)
+	return true
+}
+
+// CloseSession closes every tunnel of the session
+func (fm *ForwardManager) CloseSession(sessionID string) {
+	fm.mu.Lock()
+	var ids []string
+	for id, t := range fm.tunnels {
+		if t.sessionID == sessionID {
+			ids = append(ids, id)
+		}
+	}
+	fm.mu.Unlock()
+	for _, id := range ids {
+		fm.remove(id)
+	}
+}
+
+// checkBindAddress rejects non-loopback listen addresses unless allowed in the config
+func checkBindAddress(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if conf.Forward.AllowPublicBind {
+		return nil
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("listening on %q is not permitted; use 127.0.0.1", host)
+}
+
+// socks5Connect performs a SOCKS5 handshake (no authentication, CONNECT only)
+// on c and dials the requested destination through client
+func socks5Connect(c net.Conn, client *ssh.Client) (net.Conn, error) {
+	c.SetDeadline(time.Now().Add(30 * time.Second))
+	defer c.SetDeadline(time.Time{})
+
+	// 挨拶: VER NMETHODS METHODS...
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(c, head); err != nil {
+		return nil, err
+	}
+	if head[0] != 5 {
+		return nil, errors.New("socks: unsupported version")
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return nil, err
+	}
+	noAuth := false
+	for _, m := range methods {
+		if m == 0 {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		c.Write([]byte{5, 0xff})
+		return nil, errors.New("socks: no acceptable authentication method")
+	}
+	if _, err := c.Write([]byte{5, 0}); err != nil {
+		return nil, err
+	}
+
+	// 要求: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(c, req); err != nil {
+		return nil, err
+	}
+	if req[1] != 1 {
+		socks5Reply(c, 7) // command not supported
+		return nil, errors.New("socks: only CONNECT is supported")
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 4:
+		ip := make([]byte, 16)
+		if _, err := io.ReadFull(c, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(c, n); err != nil {
+			return nil, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(c, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		socks5Reply(c, 8) // address type not supported
+		return nil, errors.New("socks: unsupported address type")
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(c, port); err != nil {
+		return nil, err
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	remote, err := client.Dial("tcp", dest)
+	if err != nil {
+		socks5Reply(c, 5) // connection refused
+		return nil, fmt.Errorf("socks: %s: %v", dest, err)
+	}
+	if err := socks5Reply(c, 0); err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+func socks5Reply(c net.Conn, code byte) error {
+	_, err := c.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func RegisterForwardHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/forward", requireAuth(forwardPageHandler))
+	mux.HandleFunc("/api/forward", requireAuth(forwardListHandler))
+	mux.HandleFunc("/api/forward/open", requireAuth(forwardOpenHandler))
+	mux.HandleFunc("/api/forward/close", requireAuth(forwardCloseHandler))
+}
+
+func forwardPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/forward accessed")
+	auth := authFromContext(r)
+	renderTemplate(w, r, "forward", struct {
+		UserHost  string
+		ProxyBase string
+	}{
+		UserHost:  auth.UserHost(),
+		ProxyBase: proxyBase(r, auth.SessionID),
+	})
+}
+
+func forwardListHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, forwards.List(authFromContext(r).SessionID))
+}
+
+func forwardOpenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind   string `json:"kind"`
+		Listen string `json:"listen"`
+		Target string `json:"target"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	auth := authFromContext(r)
+
+	if req.Listen == "" {
+		writeJSONError(w, http.StatusBadRequest, "Listen address is required")
+		return
+	}
+	// ポート番号のみの場合はループバックで待ち受ける
+	if _, err := strconv.Atoi(req.Listen); err == nil {
+		req.Listen = net.JoinHostPort("127.0.0.1", req.Listen)
+	}
+	if req.Kind != ForwardDynamic {
+		if _, _, err := net.SplitHostPort(req.Target); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Target must be host:port")
+			return
+		}
+	}
+
+	t, err := forwards.Open(auth.SessionID, auth.Client, req.Kind, req.Listen, req.Target)
+	if err != nil {
+		logger.Warn("Failed to open %s forward %s (%s): %v", req.Kind, req.Listen, auth.UserHost(), err)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, t.snapshot())
+}
+
+func forwardCloseHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if !forwards.Close(authFromContext(r).SessionID, req.ID) {
+		writeJSONError(w, http.StatusNotFound, "Tunnel not found")
+		return
+	}
+	writeJSON(w, map[string]string{"status": "closed"})
+}
@@ -1,29 +1,63 @@
 package server
 
 import (
-	"fmt"
 	"github.com/rxxuzi/tune/internal/logger"
 	"html/template"
-	"io/ioutil"
+	"math"
 	"net/http"
-	"os/user"
-	"path/filepath"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/rxxuzi/tune/internal/config"
 	"github.com/rxxuzi/tune/internal/static"
+	"golang.org/x/crypto/ssh"
 )
 
-func RegisterHandlers(mux *http.ServeMux) {
+// 読み込まれた設定
+var conf = config.Default()
+
+func RegisterHandlers(mux *http.ServeMux, cfg *config.Config) error {
+	policy, err := NewHostPolicy(cfg.Hosts)
+	if err != nil {
+		return err
+	}
+	conf = cfg
+	hostPolicy = policy
+	loginLimiter = NewLoginLimiter(cfg.Login)
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			loginLimiter.Cleanup()
+		}
+	}()
+	if err := scheduler.Start(); err != nil {
+		return err
+	}
+
 	mux.HandleFunc("/login", loginHandler)
 	mux.HandleFunc("/login/select", loginSelectHandler)
-	mux.HandleFunc("/home", homeHandler)
-	mux.HandleFunc("/terminal", terminalHandler)
-	mux.HandleFunc("/terminal/ws", terminalWSHandler)
+	mux.HandleFunc("/home", requireAuth(homeHandler))
+	mux.HandleFunc("/terminal", requireAuth(terminalHandler))
+	mux.HandleFunc("/terminal/ws", requireAuth(terminalWSHandler))
 	mux.HandleFunc("/logout", logoutHandler)
 
 	RegisterUploaderHandlers(mux)
 	RegisterDriveHandlers(mux)
+	RegisterRunHandlers(mux)
+	RegisterFanOutHandlers(mux)
+	RegisterBroadcastHandlers(mux)
+	RegisterSnippetHandlers(mux)
+	RegisterSchedulerHandlers(mux)
+	RegisterForwardHandlers(mux)
+	RegisterProxyHandlers(mux)
+	RegisterMonitorHandlers(mux)
+	RegisterProcessHandlers(mux)
+	RegisterTailHandlers(mux)
+	RegisterServiceHandlers(mux)
+	RegisterContainerHandlers(mux)
+	RegisterEditorHandlers(mux)
+	RegisterTrashHandlers(mux)
 	// 静的ファイルのハンドラ
 	webFS := http.FS(static.SubFS)
 	fileServer := http.FileServer(webFS)
@@ -31,27 +65,13 @@ func RegisterHandlers(mux *http.ServeMux) {
 
 	// ルートは状況に応じて /login または /home へリダイレクト
 	mux.HandleFunc("/", rootRedirectHandler)
+	return nil
 }
 
 // ルートリダイレクトハンドラ
 func rootRedirectHandler(w http.ResponseWriter, r *http.Request) {
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id. Redirecting to /login")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	_, exists := sshManager.GetClient(sessionID)
-	if !exists {
-		logger.Warn("No SSH connection exists for session. Redirecting to /login")
+	if _, err := resolveAuth(r); err != nil {
+		logger.Warn("No active SSH connection (%v). Redirecting to /login", err)
 		http.Redirect(w, r, "/login", http.StatusFound)
 		return
 	}
@@ -61,8 +81,17 @@ func rootRedirectHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // テンプレートのレンダリング関数
-func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
-	tmpl, err := template.ParseFS(static.SubFS, name+".html")
+func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	token, err := csrfToken(w, r)
+	if err != nil {
+		logger.Err("Failed to create CSRF token: %v", err)
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return
+	}
+	funcs := template.FuncMap{
+		"csrfToken": func() string { return token },
+	}
+	tmpl, err := template.New(name+".html").Funcs(funcs).ParseFS(static.SubFS, name+".html")
 	if err != nil {
 		logger.Err("Failed to load template (%s): %v", name, err)
 		http.Error(w, "Template loading error", http.StatusInternalServerError)
@@ -74,16 +103,51 @@ func renderTemplate(w http.ResponseWriter, name string, data interface{}) {
 	}
 }
 
+// ホスト制限とログイン試行制限を適用してSSH接続する
+func connectForLogin(w http.ResponseWriter, r *http.Request, info *SSHInfo) (*ssh.Client, bool) {
+	ip, err := hostPolicy.Check(info.Host)
+	if err != nil {
+		logger.Warn("Login rejected by host policy: %v", err)
+		http.Error(w, "Host not permitted", http.StatusForbidden)
+		return nil, false
+	}
+
+	keys := loginKeys(r, info)
+	if wait, ok := loginLimiter.Allow(keys...); !ok {
+		secs := int(math.Ceil(wait.Seconds()))
+		logger.Warn("Login rate limited: %s -> %s (retry in %ds)", clientIP(r), info.Address(), secs)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		http.Error(w, "Too many login attempts", http.StatusTooManyRequests)
+		return nil, false
+	}
+
+	logger.Info("Attempting SSH connection: %s@%s:%d", info.User, info.Host, info.Port)
+	client, err := connectSSH(info, ip)
+	if err != nil {
+		loginLimiter.Failure(keys...)
+		logger.Err("SSH connection failed: %v", err)
+		http.Error(w, "SSH connection failed", http.StatusUnauthorized)
+		return nil, false
+	}
+	loginLimiter.Success(keys...)
+	return client, true
+}
+
 // ログインハンドラ
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("/login accessed (Method: %s)", r.Method)
 	if r.Method == http.MethodPost {
+		if !checkCSRF(w, r) {
+			return
+		}
+
 		// フォームデータの取得
 		host := r.FormValue("host")
 		user := r.FormValue("user")
 		portStr := r.FormValue("port")
 		pw := r.FormValue("password")
 		saveConnection := r.FormValue("save_connection")
+		tags := parseTags(r.FormValue("tags"))
 
 		port, err := strconv.Atoi(portStr)
 		if err != nil {
@@ -100,12 +164,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 			User:     user,
 			Port:     port,
 			Password: pw,
+			Tags:     tags,
 		}
-		logger.Info("Attempting SSH connection: %s@%s:%d", info.User, info.Host, info.Port)
-		client, err := connectSSH(&info)
-		if err != nil {
-			logger.Err("SSH connection failed: %v", err)
-			http.Error(w, "SSH connection failed", http.StatusUnauthorized)
+		client, ok := connectForLogin(w, r, &info)
+		if !ok {
 			return
 		}
 
@@ -165,7 +227,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		Hosts: hosts,
 	}
 	logger.Info("Displaying login page. Saved hosts count: %d", len(hosts))
-	renderTemplate(w, "login", data)
+	renderTemplate(w, r, "login", data)
 }
 
 // 保存済みホストからのログインハンドラ
@@ -179,33 +241,15 @@ func loginSelectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	logger.Info("Attempting connection to saved host: %s", targetHost)
-	u, err := user.Current()
+	info, err := loadSavedHost(targetHost)
 	if err != nil {
-		logger.Err("Failed to retrieve user info: %v", err)
-		http.Error(w, "User info retrieval failed", http.StatusInternalServerError)
-		return
-	}
-	cfgFile := filepath.Join(u.HomeDir, ".tune", "verify", fmt.Sprintf("ssh-%s.json", targetHost)) // filepath.Join とファイル名の形式変更
-	data, err := ioutil.ReadFile(cfgFile)
-	if err != nil {
-		logger.Err("Failed to read host config file (%s): %v", cfgFile, err)
+		logger.Err("Failed to load host config (%s): %v", targetHost, err)
 		http.Error(w, "Failed to read host config", http.StatusInternalServerError)
 		return
 	}
 
-	// ホスト設定を解析
-	info, err := parseJSONToSSHInfo(data)
-	if err != nil {
-		logger.Err("Failed to parse host config (%s): %v", cfgFile, err)
-		http.Error(w, "Failed to parse host config", http.StatusInternalServerError)
-		return
-	}
-
-	logger.Info("Attempting SSH connection: %s@%s:%d", info.User, info.Host, info.Port)
-	client, err := connectSSH(&info)
-	if err != nil {
-		logger.Err("SSH connection failed: %v", err)
-		http.Error(w, "SSH connection failed", http.StatusUnauthorized)
+	client, ok := connectForLogin(w, r, &info)
+	if !ok {
 		return
 	}
 
@@ -237,75 +281,33 @@ func loginSelectHandler(w http.ResponseWriter, r *http.Request) {
 // ホームハンドラ
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("/home accessed")
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("Session does not contain SSH information")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	user, ok := sess.Values["user"].(string)
-	if !ok || user == "" {
-		logger.Warn("Session does not contain user")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	host, ok := sess.Values["host"].(string)
-	if !ok || host == "" {
-		logger.Warn("Session does not contain host")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
+	auth := authFromContext(r)
 
 	data := struct {
 		UserHost string
 	}{
-		UserHost: user + "@" + host,
+		UserHost: auth.UserHost(),
 	}
 	logger.Info("Displaying home screen for: %s", data.UserHost)
-	renderTemplate(w, "home", data)
+	renderTemplate(w, r, "home", data)
 }
 
 // ターミナルハンドラ
 func terminalHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("/terminal accessed")
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Redirect(w, r, "/login", http.StatusFound)
+	// ?host= は保存済みホストのターミナルを開く ('exit' でログアウトしない)
+	if host := r.URL.Query().Get("host"); host != "" && host != authFromContext(r).Host {
+		renderTemplate(w, r, "terminal", terminalPageData{
+			Title:  "Tune Terminal - " + host,
+			Socket: "/terminal/ws?host=" + url.QueryEscape(host),
+		})
 		return
 	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("Session does not contain SSH information")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	renderTemplate(w, "terminal", nil)
+	renderTemplate(w, r, "terminal", terminalPageData{
+		Title:  "Tune Terminal",
+		Socket: "/terminal/ws",
+		Logout: true,
+	})
 }
 
 // ログアウトハンドラ
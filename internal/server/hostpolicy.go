@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/config"
+)
+
+// HostPolicy decides which hosts tune is permitted to connect to
+type HostPolicy struct {
+	allow []hostRule
+	deny  []hostRule
+}
+
+type hostRule struct {
+	pattern string
+	network *net.IPNet
+}
+
+// NewHostPolicy parses the allow and deny lists of the config
+func NewHostPolicy(cfg config.HostPolicy) (*HostPolicy, error) {
+	allow, err := parseHostRules(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseHostRules(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+	return &HostPolicy{allow: allow, deny: deny}, nil
+}
+
+func parseHostRules(entries []string) ([]hostRule, error) {
+	var rules []hostRule
+	for _, e := range entries {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			continue
+		}
+		if strings.Contains(e, "/") {
+			_, network, err := net.ParseCIDR(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %v", e, err)
+			}
+			rules = append(rules, hostRule{network: network})
+			continue
+		}
+		if ip := net.ParseIP(e); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			rules = append(rules, hostRule{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+			continue
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return nil, fmt.Errorf("invalid host pattern %q: %v", e, err)
+		}
+		rules = append(rules, hostRule{pattern: e})
+	}
+	return rules, nil
+}
+
+func (r hostRule) match(host string, ips []net.IP) bool {
+	if r.network != nil {
+		for _, ip := range ips {
+			if r.network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(r.pattern, host)
+	return ok
+}
+
+func matchAny(rules []hostRule, host string, ips []net.IP) bool {
+	for _, r := range rules {
+		if r.match(host, ips) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error if the host is denied or not on the allowlist.
+// Hostnames are resolved so that CIDR rules apply to every address, and the
+// vetted address is returned so that the caller dials exactly that address
+// instead of resolving the name again. It is nil when no policy is set.
+func (p *HostPolicy) Check(host string) (net.IP, error) {
+	if len(p.allow) == 0 && len(p.deny) == 0 {
+		return nil, nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve %s: %v", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("cannot resolve %s", host)
+	}
+
+	if matchAny(p.deny, host, ips) {
+		return nil, fmt.Errorf("host %s is denied", host)
+	}
+	if len(p.allow) > 0 && !matchHostname(p.allow, host) {
+		// 解決した全アドレスが許可されている必要がある
+		for _, ip := range ips {
+			if !matchAny(p.allow, "", []net.IP{ip}) {
+				return nil, fmt.Errorf("host %s is not allowed", host)
+			}
+		}
+	}
+	// 検査したアドレスに接続させて DNS リバインディングを防ぐ
+	return ips[0], nil
+}
+
+func matchHostname(rules []hostRule, host string) bool {
+	for _, r := range rules {
+		if r.network == nil && r.match(host, nil) {
+			return true
+		}
+	}
+	return false
+}
+
+var hostPolicy = &HostPolicy{}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/rxxuzi/tune/internal/config"
+)
+
+func TestHostPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  config.HostPolicy
+		host    string
+		wantIP  string
+		wantErr bool
+	}{
+		{"no policy", config.HostPolicy{}, "10.0.0.1", "", false},
+		{"allowed cidr", config.HostPolicy{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3", "10.1.2.3", false},
+		{"outside allowlist", config.HostPolicy{Allow: []string{"10.0.0.0/8"}}, "192.168.1.1", "", true},
+		{"allowed ip", config.HostPolicy{Allow: []string{"192.168.1.1"}}, "192.168.1.1", "192.168.1.1", false},
+		{"denied ip", config.HostPolicy{Deny: []string{"169.254.0.0/16"}}, "169.254.169.254", "", true},
+		{"deny wins", config.HostPolicy{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.5"}}, "10.0.0.5", "", true},
+		{"ipv6", config.HostPolicy{Allow: []string{"fd00::/8"}}, "fd00::1", "fd00::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewHostPolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("NewHostPolicy: %v", err)
+			}
+			ip, err := p.Check(tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+			got := ""
+			if ip != nil {
+				got = ip.String()
+			}
+			if got != tt.wantIP {
+				t.Errorf("Check(%q) = %q, want %q", tt.host, got, tt.wantIP)
+			}
+		})
+	}
+}
+
+func TestNewHostPolicyInvalid(t *testing.T) {
+	for _, entry := range []string{"10.0.0.0/33", "host[", "::1/200"} {
+		if _, err := NewHostPolicy(config.HostPolicy{Allow: []string{entry}}); err == nil {
+			t.Errorf("NewHostPolicy(%q) succeeded, want error", entry)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name  string
+		trust bool
+		xff   []string
+		want  string
+	}{
+		{"remote addr", false, nil, "203.0.113.7"},
+		{"header ignored", false, []string{"198.51.100.1"}, "203.0.113.7"},
+		{"single hop", true, []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left entry", true, []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"multiple headers", true, []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"empty header", true, []string{""}, "203.0.113.7"},
+	}
+	saved := conf.Login.TrustProxyHeaders
+	defer func() { conf.Login.TrustProxyHeaders = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.Login.TrustProxyHeaders = tt.trust
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "203.0.113.7:50000"
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
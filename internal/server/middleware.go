@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/gorilla/websocket"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthContext holds the session and SSH client of an authenticated request
+type AuthContext struct {
+	Session   *sessions.Session
+	SessionID string
+	Client    *ssh.Client
+	User      string
+	Host      string
+}
+
+// UserHost returns "user@host" for display
+func (a *AuthContext) UserHost() string {
+	return a.User + "@" + a.Host
+}
+
+type contextKey int
+
+const authContextKey contextKey = iota
+
+// resolveAuth resolves the session and SSH client of the request
+func resolveAuth(r *http.Request) (*AuthContext, error) {
+	sess, err := getSession(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, ok := sess.Values["session_id"].(string)
+	if !ok || sessionID == "" {
+		return nil, errors.New("session does not contain session_id")
+	}
+
+	client, exists := sshManager.GetClient(sessionID)
+	if !exists || client == nil {
+		return nil, errors.New("SSH connection does not exist for session")
+	}
+
+	user, _ := sess.Values["user"].(string)
+	host, _ := sess.Values["host"].(string)
+	if user == "" || host == "" {
+		return nil, errors.New("session does not contain user or host")
+	}
+
+	return &AuthContext{
+		Session:   sess,
+		SessionID: sessionID,
+		Client:    client,
+		User:      user,
+		Host:      host,
+	}, nil
+}
+
+// isAPIRequest reports whether the request expects a JSON error
+// instead of a redirect to the login page
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || websocket.IsWebSocketUpgrade(r)
+}
+
+// requireAuth resolves the session and SSH client into the request context.
+// Pages are redirected to /login, API and WebSocket requests get a JSON 401.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return requireAuthLogin(next, func(*http.Request) string { return "/login" })
+}
+
+// requireAuthLogin is like requireAuth but redirects pages to the URL
+// returned by login. If it returns "", they get a plain 401 instead.
+func requireAuthLogin(next http.HandlerFunc, login func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth, err := resolveAuth(r)
+		if err != nil {
+			logger.Warn("Unauthenticated request to %s: %v", r.URL.Path, err)
+			if isAPIRequest(r) {
+				writeJSONError(w, http.StatusUnauthorized, "Not logged in")
+			} else if u := login(r); u != "" {
+				http.Redirect(w, r, u, http.StatusFound)
+			} else {
+				http.Error(w, "Not logged in to tune", http.StatusUnauthorized)
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), authContextKey, auth)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// authFromContext returns the AuthContext stored by requireAuth
+func authFromContext(r *http.Request) *AuthContext {
+	auth, _ := r.Context().Value(authContextKey).(*AuthContext)
+	return auth
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"github.com/rxxuzi/tune/internal/monitor"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	monitorInterval = 2 * time.Second
+	// 保持するサンプル数 (monitorInterval 間隔で約5分)
+	monitorHistory = 150
+)
+
+// monitorMessage is sent on /monitor/ws: history, sample or error
+type monitorMessage struct {
+	Type    string           `json:"type"`
+	Samples []monitor.Sample `json:"samples,omitempty"`
+	Sample  *monitor.Sample  `json:"sample,omitempty"`
+	Message string           `json:"message,omitempty"`
+}
+
+// hostMonitor polls the host of a session while at least one dashboard is open
+type hostMonitor struct {
+	mu      sync.Mutex
+	client  *ssh.Client
+	history []monitor.Sample
+	subs    map[chan monitorMessage]struct{}
+	cancel  context.CancelFunc
+}
+
+var monitors = struct {
+	sync.Mutex
+	m map[string]*hostMonitor
+}{m: make(map[string]*hostMonitor)}
+
+func RegisterMonitorHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/monitor", requireAuth(monitorPageHandler))
+	mux.HandleFunc("/monitor/ws", requireAuth(monitorWSHandler))
+}
+
+// subscribe returns the collected history and a channel of new messages.
+// Polling starts with the first subscriber and stops after the last one leaves.
+func subscribeMonitor(sessionID string, client *ssh.Client) ([]monitor.Sample, chan monitorMessage, func()) {
+	monitors.Lock()
+	hm, ok := monitors.m[sessionID]
+	if !ok {
+		hm = &hostMonitor{client: client, subs: make(map[chan monitorMessage]struct{})}
+		monitors.m[sessionID] = hm
+	}
+	monitors.Unlock()
+
+	ch := make(chan monitorMessage, 8)
+	hm.mu.Lock()
+	hm.subs[ch] = struct{}{}
+	history := append([]monitor.Sample(nil), hm.history...)
+	if hm.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		hm.cancel = cancel
+		go hm.poll(ctx)
+	}
+	hm.mu.Unlock()
+
+	unsubscribe := func() {
+		hm.mu.Lock()
+		defer hm.mu.Unlock()
+		delete(hm.subs, ch)
+		if len(hm.subs) == 0 && hm.cancel != nil {
+			hm.cancel()
+			hm.cancel = nil
+		}
+	}
+	return history, ch, unsubscribe
+}
+
+// stopMonitor discards the monitor of a session
+func stopMonitor(sessionID string) {
+	monitors.Lock()
+	hm, ok := monitors.m[sessionID]
+	delete(monitors.m, sessionID)
+	monitors.Unlock()
+	if ok {
+		hm.mu.Lock()
+		if hm.cancel != nil {
+			hm.cancel()
+			hm.cancel = nil
+		}
+		hm.mu.Unlock()
+	}
+}
+
+func (hm *hostMonitor) poll(ctx context.Context) {
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+
+	var prev *monitor.Snapshot
+	for {
+		msg, ok := hm.sample(ctx, &prev)
+		if ctx.Err() != nil {
+			return
+		}
+		if ok {
+			hm.publish(msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish records a sample and sends the message to every dashboard
+func (hm *hostMonitor) publish(msg monitorMessage) {
+	hm.mu.Lock()
+	defer hm.mu.Unlock()
+	if msg.Sample != nil {
+		hm.history = append(hm.history, *msg.Sample)
+		if len(hm.history) > monitorHistory {
+			hm.history = hm.history[len(hm.history)-monitorHistory:]
+		}
+	}
+	for ch := range hm.subs {
+		select {
+		case ch <- msg:
+		default:
+			// 送信が詰まっている接続は読み飛ばす
+		}
+	}
+}
+
+// sample reads the host once. It reports false for the first snapshot,
+// since CPU usage and network rates need a previous one.
+func (hm *hostMonitor) sample(ctx context.Context, prev **monitor.Snapshot) (monitorMessage, bool) {
+	ctx, cancel := context.WithTimeout(ctx, monitorInterval*5)
+	defer cancel()
+
+	res, err := command.RunShell(ctx, hm.client, monitor.Script)
+	if err != nil {
+		return monitorMessage{Type: "error", Message: err.Error()}, true
+	}
+	snap, err := monitor.Parse(res.Stdout, time.Now())
+	if err != nil {
+		return monitorMessage{Type: "error", Message: err.Error()}, true
+	}
+	smp := snap.Sample(*prev)
+	first := *prev == nil
+	*prev = snap
+	return monitorMessage{Type: "sample", Sample: &smp}, !first
+}
+
+func monitorPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/monitor accessed")
+	renderTemplate(w, r, "monitor", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func monitorWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Err("Monitor: WebSocket upgrade failed: %v", err)
+		return
+	}
+	conn := &wsConn{Conn: ws}
+	defer conn.Close()
+
+	history, ch, unsubscribe := subscribeMonitor(auth.SessionID, auth.Client)
+	defer unsubscribe()
+
+	if history == nil {
+		history = []monitor.Sample{}
+	}
+	if err := conn.WriteJSON(monitorMessage{Type: "history", Samples: history}); err != nil {
+		return
+	}
+
+	// クライアントからの切断を検出
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg := <-ch:
+			if err := conn.WriteJSON(msg); err != nil {
+				logger.Warn("Monitor: failed to send sample: %v", err)
+				return
+			}
+		}
+	}
+}
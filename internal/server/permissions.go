@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// FileAttrs is the mode and ownership of a drive file
+type FileAttrs struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"`
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+}
+
+// PathResult is the outcome of an operation on one selected path
+type PathResult struct {
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	// 8 進数 (755, 2775) または記号表記 (u+x,go-w)
+	octalMode    = regexp.MustCompile(`^[0-7]{3,4}$`)
+	symbolicMode = regexp.MustCompile(`^[ugoa]*([-+=][rwxXst]*)+(,[ugoa]*([-+=][rwxXst]*)+)*$`)
+	// ユーザー名・グループ名または数値 ID
+	accountName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*\$?$`)
+)
+
+func validMode(mode string) bool {
+	return octalMode.MatchString(mode) || symbolicMode.MatchString(mode)
+}
+
+// statAttrs reads the mode and ownership of abs
+func statAttrs(ctx context.Context, client *ssh.Client, abs string) (*FileAttrs, error) {
+	out, err := command.Output(ctx, client, "stat", "-L", "-c", "%a\t%U\t%G\t%u\t%g\t%F", "--", abs)
+	if err != nil {
+		return nil, err
+	}
+	f := strings.SplitN(out, "\t", 6)
+	if len(f) < 6 {
+		return nil, fmt.Errorf("unexpected stat output: %q", out)
+	}
+	attrs := &FileAttrs{Owner: f[1], Group: f[2], Type: f[5]}
+	mode, err := strconv.ParseUint(f[0], 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected mode: %q", f[0])
+	}
+	attrs.Mode = fmt.Sprintf("%04o", mode)
+	attrs.UID, _ = strconv.Atoi(f[3])
+	attrs.GID, _ = strconv.Atoi(f[4])
+	return attrs, nil
+}
+
+func driveStatHandler(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	client := authFromContext(r).Client
+	root, absPath, ok := requestPath(w, r, file)
+	if !ok {
+		return
+	}
+	attrs, err := statAttrs(r.Context(), client, absPath)
+	if err != nil {
+		logger.Err("Failed to stat %s: %v", absPath, err)
+		writeJSONError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	attrs.Path = relativePath(root, absPath)
+	writeJSON(w, attrs)
+}
+
+// applyToPaths resolves each path inside the drive root and runs the
+// command built by argv for it, collecting an error per path
+func applyToPaths(r *http.Request, paths []string, argv func(abs string) []string) []PathResult {
+	auth := authFromContext(r)
+	results := make([]PathResult, 0, len(paths))
+	root, err := driveRoot(r.Context(), auth)
+	if err != nil {
+		for _, p := range paths {
+			results = append(results, PathResult{Path: p, Error: "failed to resolve drive root"})
+		}
+		return results
+	}
+
+	for _, p := range paths {
+		res := PathResult{Path: p}
+		abs, err := resolvePath(r.Context(), auth.Client, root, p)
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		out, err := command.Run(r.Context(), auth.Client, privileged(auth.Host, argv(abs)...)...)
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case out.ExitCode != 0:
+			res.Error = strings.TrimSpace(out.Stderr)
+		default:
+			res.OK = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func driveChmodHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paths     []string `json:"paths"`
+		Mode      string   `json:"mode"`
+		Recursive bool     `json:"recursive"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if !validMode(req.Mode) {
+		writeJSONError(w, http.StatusBadRequest, "Invalid mode: "+req.Mode)
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No files selected")
+		return
+	}
+
+	results := applyToPaths(r, req.Paths, func(abs string) []string {
+		if req.Recursive {
+			return []string{"chmod", "-R", req.Mode, "--", abs}
+		}
+		return []string{"chmod", req.Mode, "--", abs}
+	})
+	logger.Info("chmod %s (recursive=%v) by %s on %d paths", req.Mode, req.Recursive, authFromContext(r).UserHost(), len(req.Paths))
+	writeJSON(w, results)
+}
+
+func driveChownHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paths     []string `json:"paths"`
+		Owner     string   `json:"owner"`
+		Group     string   `json:"group"`
+		Recursive bool     `json:"recursive"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if req.Owner == "" && req.Group == "" {
+		writeJSONError(w, http.StatusBadRequest, "Owner or group is required")
+		return
+	}
+	for _, name := range []string{req.Owner, req.Group} {
+		if name != "" && !accountName.MatchString(name) {
+			writeJSONError(w, http.StatusBadRequest, "Invalid owner or group: "+name)
+			return
+		}
+	}
+	if len(req.Paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No files selected")
+		return
+	}
+
+	spec := req.Owner
+	if req.Group != "" {
+		spec += ":" + req.Group
+	}
+	results := applyToPaths(r, req.Paths, func(abs string) []string {
+		if req.Recursive {
+			return []string{"chown", "-R", spec, "--", abs}
+		}
+		return []string{"chown", spec, "--", abs}
+	})
+	logger.Info("chown %s (recursive=%v) by %s on %d paths", spec, req.Recursive, authFromContext(r).UserHost(), len(req.Paths))
+	writeJSON(w, results)
+}
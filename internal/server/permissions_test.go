@@ -0,0 +1,57 @@
+package server
+
+import "testing"
+
+func TestValidMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{"755", true},
+		{"0644", true},
+		{"2775", true},
+		{"u+x", true},
+		{"go-w", true},
+		{"a=r", true},
+		{"u+rwx,g+rx,o-rwx", true},
+		{"+X", true},
+		{"u+s,g+s,+t", true},
+		{"u=", true},
+		{"", false},
+		{"75", false},
+		{"77777", false},
+		{"788", false},
+		{"u+z", false},
+		{"x+u", false},
+		{"u+x,", false},
+		{"-R 755", false},
+		{"755 /etc", false},
+		{"u+x;reboot", false},
+	}
+	for _, tt := range tests {
+		if got := validMode(tt.mode); got != tt.want {
+			t.Errorf("validMode(%q) = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAccountName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"root":      true,
+		"www-data":  true,
+		"john.doe":  true,
+		"1000":      true,
+		"machine$":  true,
+		"_apt":      true,
+		"":          false,
+		"-rf":       false,
+		"a:b":       false,
+		"a b":       false,
+		"../etc":    false,
+		"user$name": false,
+	} {
+		if got := accountName.MatchString(name); got != want {
+			t.Errorf("accountName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"github.com/rxxuzi/tune/internal/monitor"
+)
+
+// プロセスに送信できるシグナル
+var processSignals = map[string]bool{
+	"TERM": true,
+	"KILL": true,
+	"HUP":  true,
+}
+
+// SignalResult is the outcome of signalling a single process
+type SignalResult struct {
+	PID   int    `json:"pid"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func RegisterProcessHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/processes", requireAuth(processPageHandler))
+	mux.HandleFunc("/api/processes", requireAuth(processListHandler))
+	mux.HandleFunc("/api/processes/signal", requireAuth(processSignalHandler))
+}
+
+func processPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/processes accessed")
+	renderTemplate(w, r, "processes", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+// processListHandler lists processes.
+// Query: filter (user or command substring), sort (pid|user|cpu|mem|rss|started|command), order (asc|desc)
+func processListHandler(w http.ResponseWriter, r *http.Request) {
+	client := authFromContext(r).Client
+	out, err := command.Output(r.Context(), client, monitor.PSArgs...)
+	if err != nil {
+		logger.Err("Failed to list processes: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list processes")
+		return
+	}
+	procs, err := monitor.ParseProcesses(out, time.Now())
+	if err != nil {
+		logger.Err("Failed to parse process list: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to parse process list")
+		return
+	}
+
+	q := r.URL.Query()
+	if filter := strings.ToLower(q.Get("filter")); filter != "" {
+		matched := procs[:0]
+		for _, p := range procs {
+			if strings.Contains(strings.ToLower(p.Command), filter) ||
+				strings.Contains(strings.ToLower(p.User), filter) ||
+				strconv.Itoa(p.PID) == filter {
+				matched = append(matched, p)
+			}
+		}
+		procs = matched
+	}
+
+	less := map[string]func(a, b monitor.Process) bool{
+		"pid":     func(a, b monitor.Process) bool { return a.PID < b.PID },
+		"user":    func(a, b monitor.Process) bool { return a.User < b.User },
+		"cpu":     func(a, b monitor.Process) bool { return a.CPU < b.CPU },
+		"mem":     func(a, b monitor.Process) bool { return a.Mem < b.Mem },
+		"rss":     func(a, b monitor.Process) bool { return a.RSS < b.RSS },
+		"started": func(a, b monitor.Process) bool { return a.Started.Before(b.Started) },
+		"command": func(a, b monitor.Process) bool { return a.Command < b.Command },
+	}[q.Get("sort")]
+	if less == nil {
+		less = func(a, b monitor.Process) bool { return a.CPU < b.CPU }
+	}
+	desc := q.Get("order") != "asc"
+	sort.SliceStable(procs, func(i, j int) bool {
+		if desc {
+			return less(procs[j], procs[i])
+		}
+		return less(procs[i], procs[j])
+	})
+
+	if procs == nil {
+		procs = []monitor.Process{}
+	}
+	writeJSON(w, procs)
+}
+
+func processSignalHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PIDs   []int  `json:"pids"`
+		Signal string `json:"signal"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if !processSignals[req.Signal] {
+		writeJSONError(w, http.StatusBadRequest, "Unsupported signal: "+req.Signal)
+		return
+	}
+	if len(req.PIDs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No processes selected")
+		return
+	}
+	auth := authFromContext(r)
+
+	results := make([]SignalResult, 0, len(req.PIDs))
+	for _, pid := range req.PIDs {
+		res := SignalResult{PID: pid}
+		if pid <= 1 {
+			res.Error = "refusing to signal this pid"
+			results = append(results, res)
+			continue
+		}
+		out, err := command.Run(r.Context(), auth.Client, "kill", "-s", req.Signal, "--", strconv.Itoa(pid))
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case out.ExitCode != 0:
+			res.Error = strings.TrimSpace(out.Stderr)
+		default:
+			res.OK = true
+		}
+		if res.OK {
+			logger.Info("Process signal: %s sent SIG%s to pid %d", auth.UserHost(), req.Signal, pid)
+		} else {
+			logger.Warn("Process signal: %s failed to send SIG%s to pid %d: %s", auth.UserHost(), req.Signal, pid, res.Error)
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, results)
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// /proxy/<session>/<port>/... をリモートホストの 127.0.0.1:<port> へ中継する。
+// proxy.listen を設定すると別オリジンで配信し、tune のオリジンからは転送する。
+
+const proxyPrefix = "/proxy/"
+
+// proxySandbox is added to proxied responses when the apps are served from
+// their own origin. allow-same-origin keeps that origin, so the app's
+// cookies and tune's session cookie are still sent with its requests.
+// On tune's origin no sandbox is added, since an opaque origin would drop
+// the session cookie and break every subresource request.
+const proxySandbox = "sandbox allow-scripts allow-forms allow-same-origin"
+
+func RegisterProxyHandlers(mux *http.ServeMux) {
+	if conf.Proxy.Listen != "" {
+		mux.HandleFunc(proxyPrefix, requireAuth(proxyRedirectHandler))
+		return
+	}
+	mux.HandleFunc(proxyPrefix, requireAuth(proxyHandler))
+}
+
+// ProxyHandler serves only the proxied apps, for the listener on
+// proxy.listen. Every other path is not found. Requests that are not
+// logged in are sent to the login page of tune on tunePort.
+func ProxyHandler(tunePort string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(proxyPrefix, requireAuthLogin(proxyHandler, func(r *http.Request) string {
+		return tuneLoginURL(r, tunePort)
+	}))
+	mux.HandleFunc("/", http.NotFound)
+	return mux
+}
+
+// tuneLoginURL returns the login page of tune for a request to the proxy
+// listener. With proxy.origin set tune's own URL is unknown, so it returns "".
+func tuneLoginURL(r *http.Request, tunePort string) string {
+	if conf.Proxy.Origin != "" {
+		return ""
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, tunePort) + "/login"
+}
+
+// proxyOrigin returns the origin the proxied apps are served from,
+// or "" when they are served by tune itself
+func proxyOrigin(r *http.Request) string {
+	if conf.Proxy.Origin != "" {
+		return strings.TrimSuffix(conf.Proxy.Origin, "/")
+	}
+	if conf.Proxy.Listen == "" {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(conf.Proxy.Listen)
+	if err != nil {
+		return ""
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// proxyBase is the URL under which the session's ports are proxied
+func proxyBase(r *http.Request, sessionID string) string {
+	return proxyOrigin(r) + proxyPrefix + sessionID + "/"
+}
+
+// proxyRedirectHandler sends /proxy/ requests on tune's origin to the proxy origin
+func proxyRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, proxyOrigin(r)+r.URL.RequestURI(), http.StatusFound)
+}
+
+// セッションごとの Transport (SSH 経由で接続し、接続を使い回す)
+var proxyTransports = struct {
+	sync.Mutex
+	m map[string]*http.Transport
+}{m: make(map[string]*http.Transport)}
+
+func proxyTransport(sessionID string, client *ssh.Client) *http.Transport {
+	proxyTransports.Lock()
+	defer proxyTransports.Unlock()
+	if t, ok := proxyTransports.m[sessionID]; ok {
+		return t
+	}
+	t := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client.Dial(network, addr)
+		},
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 2 * time.Minute,
+	}
+	proxyTransports.m[sessionID] = t
+	return t
+}
+
+// closeProxyTransport drops the cached transport of a session
+func closeProxyTransport(sessionID string) {
+	proxyTransports.Lock()
+	t, ok := proxyTransports.m[sessionID]
+	delete(proxyTransports.m, sessionID)
+	proxyTransports.Unlock()
+	if ok {
+		t.CloseIdleConnections()
+	}
+}
+
+func proxyHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	if conf.Proxy.Listen != "" {
+		// アプリ自身の CSP がある場合も両方が適用される
+		w.Header().Add("Content-Security-Policy", proxySandbox)
+	}
+
+	// /proxy/<session>/<port>/<rest>
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, proxyPrefix), "/", 3)
+	if len(parts) < 2 {
+		http.Error(w, "Usage: /proxy/<session>/<port>/", http.StatusNotFound)
+		return
+	}
+	if parts[0] != auth.SessionID {
+		logger.Warn("Proxy request for another session rejected (%s)", auth.UserHost())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	port, err := strconv.Atoi(parts[1])
+	if err != nil || port < 1 || port > 65535 {
+		http.Error(w, "Invalid port", http.StatusBadRequest)
+		return
+	}
+	prefix := proxyPrefix + parts[0] + "/" + parts[1]
+	if len(parts) == 2 {
+		// 相対パスが正しく解決されるように末尾のスラッシュを付ける
+		target := prefix + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	targetHost := net.JoinHostPort("127.0.0.1", parts[1])
+	rp := &httputil.ReverseProxy{
+		Transport: proxyTransport(auth.SessionID, auth.Client),
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = targetHost
+			req.URL.Path = "/" + parts[2]
+			req.URL.RawPath = ""
+			req.Host = "localhost:" + parts[1]
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+			stripCookie(req, sessionName)
+			req.Header.Del("X-CSRF-Token")
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			rewriteLocation(resp, prefix, port)
+			rewriteCookies(resp, prefix)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Warn("Proxy to %s:%d failed: %v", auth.Host, port, err)
+			http.Error(w, "Bad gateway: "+err.Error(), http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// stripCookie removes tune's own cookie so it is not sent to the remote app
+func stripCookie(req *http.Request, name string) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			req.AddCookie(c)
+		}
+	}
+}
+
+// rewriteLocation maps redirects of the remote app under the proxy prefix
+func rewriteLocation(resp *http.Response, prefix string, port int) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return
+	}
+	if u.IsAbs() {
+		// アプリ自身を指す絶対URLのみ書き換える
+		host := u.Hostname()
+		if host != "localhost" && host != "127.0.0.1" && host != "::1" {
+			return
+		}
+		if p := u.Port(); p != "" && p != strconv.Itoa(port) {
+			return
+		}
+		u.Scheme, u.Host = "", ""
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		// 相対パスはそのままで正しく解決される
+		return
+	}
+	u.Path = prefix + u.Path
+	u.RawPath = ""
+	resp.Header.Set("Location", u.String())
+}
+
+// rewriteCookies scopes cookies set by the remote app to the proxy prefix
+func rewriteCookies(resp *http.Response, prefix string) {
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	resp.Header.Del("Set-Cookie")
+	for _, c := range cookies {
+		if c.Name == sessionName {
+			// tune のセッションを上書きさせない
+			continue
+		}
+		p := c.Path
+		if p == "" {
+			p = "/"
+		}
+		c.Path = path.Join(prefix, p)
+		if strings.HasSuffix(p, "/") && p != "/" {
+			c.Path += "/"
+		}
+		c.Domain = ""
+		resp.Header.Add("Set-Cookie", c.String())
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rxxuzi/tune/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProxyOrigin(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy config.ProxyConfig
+		host  string
+		tls   bool
+		want  string
+	}{
+		{"same origin", config.ProxyConfig{}, "example.com:9000", false, ""},
+		{"listener port", config.ProxyConfig{Listen: ":9001"}, "example.com:9000", false, "http://example.com:9001"},
+		{"https", config.ProxyConfig{Listen: "0.0.0.0:9001"}, "example.com", true, "https://example.com:9001"},
+		{"ipv6 host", config.ProxyConfig{Listen: ":9001"}, "[::1]:9000", false, "http://[::1]:9001"},
+		{"explicit origin", config.ProxyConfig{Listen: ":9001", Origin: "https://apps.example.com/"}, "example.com", true, "https://apps.example.com"},
+	}
+	saved := conf.Proxy
+	defer func() { conf.Proxy = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.Proxy = tt.proxy
+			r := httptest.NewRequest(http.MethodGet, "/forward", nil)
+			r.Host = tt.host
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if got := proxyOrigin(r); got != tt.want {
+				t.Errorf("proxyOrigin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 別オリジンで配信するときだけ、エラーでも必ずサンドボックスの CSP が付く
+func TestProxyHandlerSandbox(t *testing.T) {
+	saved := conf.Proxy
+	defer func() { conf.Proxy = saved }()
+	for _, listen := range []string{"", ":9001"} {
+		conf.Proxy = config.ProxyConfig{Listen: listen}
+		want := ""
+		if listen != "" {
+			want = proxySandbox
+		}
+		for _, p := range []string{"/proxy/s1/notaport/", "/proxy/other/8080/", "/proxy/s1/8080"} {
+			r := httptest.NewRequest(http.MethodGet, p, nil)
+			r = r.WithContext(context.WithValue(r.Context(), authContextKey, &AuthContext{SessionID: "s1"}))
+			w := httptest.NewRecorder()
+			proxyHandler(w, r)
+			if got := w.Header().Get("Content-Security-Policy"); got != want {
+				t.Errorf("listen %q, %s: Content-Security-Policy = %q, want %q", listen, p, got, want)
+			}
+		}
+	}
+	if !strings.Contains(proxySandbox, "allow-same-origin") {
+		t.Errorf("proxySandbox %q gives the app an opaque origin", proxySandbox)
+	}
+}
+
+func TestProxyListenerLogin(t *testing.T) {
+	saved := conf.Proxy
+	defer func() { conf.Proxy = saved }()
+	tests := []struct {
+		name   string
+		proxy  config.ProxyConfig
+		status int
+		want   string
+	}{
+		{"redirect to tune", config.ProxyConfig{Listen: ":9001"}, http.StatusFound, "http://example.com:9000/login"},
+		{"unknown tune origin", config.ProxyConfig{Listen: ":9001", Origin: "https://apps.example.com"}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.Proxy = tt.proxy
+			r := httptest.NewRequest(http.MethodGet, "/proxy/s1/8080/", nil)
+			r.Host = "example.com:9001"
+			w := httptest.NewRecorder()
+			ProxyHandler("9000").ServeHTTP(w, r)
+			if w.Code != tt.status || w.Header().Get("Location") != tt.want {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Header().Get("Location"), tt.status, tt.want)
+			}
+		})
+	}
+}
+
+// startTestSSH returns an SSH client whose direct-tcpip channels are
+// connected to addr, standing in for the remote host
+func startTestSSH(t *testing.T, addr string) *ssh.Client {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConf := &ssh.ServerConfig{NoClientAuth: true}
+	serverConf.AddHostKey(signer)
+
+	// net.Pipe はバッファがなくバージョン交換で詰まるので TCP を使う
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(c, serverConf)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for nc := range chans {
+			if nc.ChannelType() != "direct-tcpip" {
+				nc.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+			ch, creqs, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			go ssh.DiscardRequests(creqs)
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				ch.Close()
+				continue
+			}
+			go func() {
+				io.Copy(conn, ch)
+				conn.Close()
+			}()
+			go func() {
+				io.Copy(ch, conn)
+				ch.Close()
+			}()
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+		User:            "u",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// アプリのサブリソースへのリクエストが tune のセッション Cookie で認証され、
+// Cookie はアプリへ渡されないこと
+func TestProxySubresourceWithCookie(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie(sessionName); err == nil {
+			http.Error(w, "tune session leaked", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, "asset "+r.URL.Path)
+	}))
+	defer app.Close()
+	_, port, _ := net.SplitHostPort(app.Listener.Addr().String())
+
+	sshManager.AddClient("s-proxy", startTestSSH(t, app.Listener.Addr().String()))
+	defer sshManager.RemoveClient("s-proxy")
+
+	// ログイン済みのセッション Cookie を作る
+	lr := httptest.NewRequest(http.MethodGet, "/login", nil)
+	sess, _ := getSession(lr)
+	sess.Values["session_id"] = "s-proxy"
+	sess.Values["user"] = "u"
+	sess.Values["host"] = "example.com"
+	lw := httptest.NewRecorder()
+	if err := sess.Save(lr, lw); err != nil {
+		t.Fatal(err)
+	}
+	cookie := lw.Result().Cookies()[0]
+
+	saved := conf.Proxy
+	defer func() { conf.Proxy = saved }()
+	for _, listen := range []string{"", ":9001"} {
+		conf.Proxy = config.ProxyConfig{Listen: listen}
+		var h http.Handler
+		if listen == "" {
+			mux := http.NewServeMux()
+			RegisterProxyHandlers(mux)
+			h = mux
+		} else {
+			h = ProxyHandler("9000")
+		}
+		r := httptest.NewRequest(http.MethodGet, "/proxy/s-proxy/"+port+"/static/app.js", nil)
+		r.Header.Set("Sec-Fetch-Dest", "script")
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || w.Body.String() != "asset /static/app.js" {
+			t.Errorf("listen %q: got %d %q", listen, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PTY の固定サイズ
+const (
+	ptyHeight = 32
+	ptyWidth  = 120
+)
+
+// ptySession is an SSH session running in a PTY
+type ptySession struct {
+	*ssh.Session
+	stdin  io.WriteCloser
+	stdout io.Reader
+	stderr io.Reader
+}
+
+// startPTY requests a PTY and starts cmd in it, or the login shell if cmd is empty
+func startPTY(client *ssh.Client, cmd string) (*ptySession, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %v", err)
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,     // エコーを有効にする
+		ssh.TTY_OP_ISPEED: 14400, // 入力速度
+		ssh.TTY_OP_OSPEED: 14400, // 出力速度
+	}
+	if err := session.RequestPty("xterm", ptyHeight, ptyWidth, modes); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("PTY request failed: %v", err)
+	}
+
+	p := &ptySession{Session: session}
+	if p.stdin, err = session.StdinPipe(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	if p.stdout, err = session.StdoutPipe(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	if p.stderr, err = session.StderrPipe(); err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	if cmd == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(cmd)
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return p, nil
+}
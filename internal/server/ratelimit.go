@@ -0,0 +1,160 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/config"
+)
+
+// attemptState tracks login attempts for a single key (client IP or target)
+type attemptState struct {
+	attempts     []time.Time
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// LoginLimiter applies rate limiting, exponential backoff and lockouts
+// to login attempts, keyed by client IP and by SSH target.
+type LoginLimiter struct {
+	mu      sync.Mutex
+	cfg     config.LoginConfig
+	entries map[string]*attemptState
+}
+
+// NewLoginLimiter creates a new LoginLimiter
+func NewLoginLimiter(cfg config.LoginConfig) *LoginLimiter {
+	return &LoginLimiter{
+		cfg:     cfg,
+		entries: make(map[string]*attemptState),
+	}
+}
+
+func (l *LoginLimiter) entry(key string, now time.Time) *attemptState {
+	st, exists := l.entries[key]
+	if !exists {
+		st = &attemptState{}
+		l.entries[key] = st
+	}
+	// 一定時間失敗がなければリセット
+	if st.failures > 0 && l.cfg.ResetAfter > 0 && now.Sub(st.lastFailure) > l.cfg.ResetAfter.Std() {
+		st.failures = 0
+	}
+	// 1分より古い試行を削除
+	recent := st.attempts[:0]
+	for _, t := range st.attempts {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	st.attempts = recent
+	return st
+}
+
+// Allow records an attempt for all keys and reports how long the caller
+// must wait if any of them is rate limited, backing off or locked out.
+func (l *LoginLimiter) Allow(keys ...string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+
+	var wait time.Duration
+	for _, key := range keys {
+		st := l.entry(key, now)
+		if now.Before(st.blockedUntil) {
+			wait = max(wait, st.blockedUntil.Sub(now))
+		}
+		if l.cfg.AttemptsPerMinute > 0 && len(st.attempts) >= l.cfg.AttemptsPerMinute {
+			wait = max(wait, st.attempts[0].Add(time.Minute).Sub(now))
+		}
+	}
+	if wait > 0 {
+		return wait, false
+	}
+	for _, key := range keys {
+		st := l.entries[key]
+		st.attempts = append(st.attempts, now)
+	}
+	return 0, true
+}
+
+// Failure records a failed login for all keys
+func (l *LoginLimiter) Failure(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+
+	for _, key := range keys {
+		st := l.entry(key, now)
+		st.failures++
+		st.lastFailure = now
+		if l.cfg.MaxFailures > 0 && st.failures >= l.cfg.MaxFailures {
+			st.blockedUntil = now.Add(l.cfg.Lockout.Std())
+			continue
+		}
+		delay := l.cfg.BaseDelay.Std() << (st.failures - 1)
+		if l.cfg.MaxDelay > 0 && (delay > l.cfg.MaxDelay.Std() || delay <= 0) {
+			delay = l.cfg.MaxDelay.Std()
+		}
+		st.blockedUntil = now.Add(delay)
+	}
+}
+
+// Success clears the failure state for all keys
+func (l *LoginLimiter) Success(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if st, exists := l.entries[key]; exists {
+			st.failures = 0
+			st.blockedUntil = time.Time{}
+		}
+	}
+}
+
+// Cleanup removes entries that no longer hold any state
+func (l *LoginLimiter) Cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for key := range l.entries {
+		st := l.entry(key, now)
+		if st.failures == 0 && len(st.attempts) == 0 && now.After(st.blockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// clientIP returns the IP address of the client making the request.
+// Behind a trusted proxy it is the rightmost X-Forwarded-For entry, the
+// one appended by the proxy; entries to its left come from the client.
+func clientIP(r *http.Request) string {
+	if conf.Login.TrustProxyHeaders {
+		fwd := r.Header.Values("X-Forwarded-For")
+		if len(fwd) > 0 {
+			parts := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginKeys returns the limiter keys for a login attempt
+func loginKeys(r *http.Request, info *SSHInfo) []string {
+	return []string{
+		"ip:" + clientIP(r),
+		"target:" + strings.ToLower(info.Address()),
+	}
+}
+
+var loginLimiter = NewLoginLimiter(config.Default().Login)
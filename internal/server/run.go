@@ -0,0 +1,153 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// runMessage is a message exchanged on /run/ws.
+// Client: {"type":"start","command":"..."} / {"type":"signal","signal":"INT"}
+// Server: started, line, exit, error
+type runMessage struct {
+	Type       string `json:"type"`
+	Command    string `json:"command,omitempty"`
+	Signal     string `json:"signal,omitempty"`
+	Stream     string `json:"stream,omitempty"`
+	Data       string `json:"data,omitempty"`
+	Code       int    `json:"code"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// 送信可能なシグナル
+var runSignals = map[string]ssh.Signal{
+	"INT":  ssh.SIGINT,
+	"TERM": ssh.SIGTERM,
+	"KILL": ssh.SIGKILL,
+	"HUP":  ssh.SIGHUP,
+}
+
+func RegisterRunHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/run", requireAuth(runPageHandler))
+	mux.HandleFunc("/run/ws", requireAuth(runWSHandler))
+}
+
+func runPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/run accessed")
+	renderTemplate(w, r, "run", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func runWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Err("Run: WebSocket upgrade failed: %v", err)
+		return
+	}
+	conn := &wsConn{Conn: ws}
+	defer conn.Close()
+
+	var (
+		mu   sync.Mutex
+		proc *command.Process
+	)
+	defer func() {
+		// 接続が切れたら実行中のコマンドを終了
+		mu.Lock()
+		defer mu.Unlock()
+		if proc != nil {
+			proc.Signal(ssh.SIGKILL)
+			proc.Close()
+		}
+	}()
+
+	for {
+		var msg runMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Err("Run: Unexpected client disconnection: %v", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "start":
+			mu.Lock()
+			running := proc != nil
+			mu.Unlock()
+			if running {
+				conn.WriteJSON(runMessage{Type: "error", Message: "A command is already running"})
+				continue
+			}
+			cmd := strings.TrimSpace(msg.Command)
+			if cmd == "" {
+				conn.WriteJSON(runMessage{Type: "error", Message: "Command is empty"})
+				continue
+			}
+
+			logger.Info("Run (%s): %s", auth.UserHost(), cmd)
+			start := time.Now()
+			p, err := command.StartShell(auth.Client, cmd, func(stream, line string) {
+				conn.WriteJSON(runMessage{Type: "line", Stream: stream, Data: line})
+			})
+			if err != nil {
+				logger.Err("Run: Failed to start command: %v", err)
+				conn.WriteJSON(runMessage{Type: "error", Message: "Failed to start command"})
+				continue
+			}
+			mu.Lock()
+			proc = p
+			mu.Unlock()
+			conn.WriteJSON(runMessage{Type: "started", Command: cmd})
+
+			go func() {
+				code, err := p.Wait()
+				mu.Lock()
+				proc = nil
+				mu.Unlock()
+				reply := runMessage{Type: "exit", Code: code, DurationMs: time.Since(start).Milliseconds()}
+				if err != nil {
+					reply.Message = err.Error()
+				}
+				logger.Info("Run (%s) exited with %d: %s", auth.UserHost(), code, cmd)
+				conn.WriteJSON(reply)
+			}()
+
+		case "signal":
+			sig, ok := runSignals[msg.Signal]
+			if !ok {
+				conn.WriteJSON(runMessage{Type: "error", Message: "Unknown signal: " + msg.Signal})
+				continue
+			}
+			mu.Lock()
+			p := proc
+			mu.Unlock()
+			if p == nil {
+				continue
+			}
+			logger.Info("Run (%s): sending SIG%s", auth.UserHost(), msg.Signal)
+			if err := p.Signal(sig); err != nil {
+				logger.Warn("Run: Failed to send signal: %v", err)
+			}
+			if sig == ssh.SIGKILL {
+				// シグナル非対応のサーバーでもセッションを閉じて止める
+				p.Close()
+			}
+
+		default:
+			conn.WriteJSON(runMessage{Type: "error", Message: "Unknown message type: " + msg.Type})
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rxxuzi/tune/internal/config"
+	"github.com/rxxuzi/tune/internal/cron"
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+// Job is a command run on a saved host on a cron schedule
+type Job struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Host     string `json:"host"`
+	Command  string `json:"command"`
+	Enabled  bool   `json:"enabled"`
+	// Retries is the number of extra attempts after a failure
+	Retries    int             `json:"retries"`
+	RetryDelay config.Duration `json:"retry_delay"`
+	Timeout    config.Duration `json:"timeout"`
+}
+
+// JobRun is a single execution of a job
+type JobRun struct {
+	JobID      string    `json:"job_id"`
+	Started    time.Time `json:"started"`
+	Attempt    int       `json:"attempt"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMs int64     `json:"duration_ms"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	Error      string    `json:"error,omitempty"`
+	Manual     bool      `json:"manual"`
+}
+
+// ジョブごとに保存する実行履歴の件数と出力の上限
+const (
+	maxJobHistory = 50
+	maxJobOutput  = 64 * 1024
+)
+
+// Scheduler runs jobs stored in ~/.tune/jobs.json and records their history
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []Job
+	next    map[string]time.Time
+	running map[string]bool
+	wake    chan struct{}
+}
+
+var scheduler = &Scheduler{
+	next:    make(map[string]time.Time),
+	running: make(map[string]bool),
+	wake:    make(chan struct{}, 1),
+}
+
+func RegisterSchedulerHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/jobs", requireAuth(jobsPageHandler))
+	mux.HandleFunc("/api/jobs", requireAuth(jobListHandler))
+	mux.HandleFunc("/api/jobs/save", requireAuth(jobSaveHandler))
+	mux.HandleFunc("/api/jobs/delete", requireAuth(jobDeleteHandler))
+	mux.HandleFunc("/api/jobs/run", requireAuth(jobRunNowHandler))
+	mux.HandleFunc("/api/jobs/history", requireAuth(jobHistoryHandler))
+}
+
+func jobsPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobs.json"), nil
+}
+
+// jobHistoryPath returns the history file of a job. Only IDs in the
+// canonical UUID form generated for new jobs are accepted, so an ID can
+// never contain a path separator or ".." and name a file elsewhere.
+func jobHistoryPath(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil || len(id) != 36 {
+		return "", fmt.Errorf("invalid job id: %q", id)
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobs", id+".json"), nil
+}
+
+// readJSONFile decodes a JSON file into v, leaving v untouched if the file does not exist
+func readJSONFile(p string, v interface{}) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSONFile writes v to p, creating the parent directory
+func writeJSONFile(p string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+// Start loads the jobs and runs the scheduling loop in the background
+func (s *Scheduler) Start() error {
+	p, err := jobsPath()
+	if err != nil {
+		return err
+	}
+	var jobs []Job
+	if err := readJSONFile(p, &jobs); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+
+	s.mu.Lock()
+	s.jobs = jobs
+	s.reschedule(time.Now())
+	s.mu.Unlock()
+
+	logger.Info("Scheduler started with %d jobs", len(jobs))
+	go s.loop()
+	return nil
+}
+
+// reschedule computes the next run time of every enabled job. s.mu must be held.
+func (s *Scheduler) reschedule(now time.Time) {
+	s.next = make(map[string]time.Time)
+	for _, j := range s.jobs {
+		if !j.Enabled {
+			continue
+		}
+		sched, err := cron.Parse(j.Schedule)
+		if err != nil {
+			logger.Warn("Scheduler: job %q has an invalid schedule: %v", j.Name, err)
+			continue
+		}
+		if t := sched.Next(now); !t.IsZero() {
+			s.next[j.ID] = t
+		}
+	}
+}
+
+func (s *Scheduler) loop() {
+	for {
+		s.mu.Lock()
+		wait := time.Minute
+		now := time.Now()
+		for _, t := range s.next {
+			if d := t.Sub(now); d < wait {
+				wait = d
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(max(wait, 0)):
+		case <-s.wake:
+			continue
+		}
+
+		now = time.Now()
+		s.mu.Lock()
+		var due []Job
+		for _, j := range s.jobs {
+			t, ok := s.next[j.ID]
+			if !ok || t.After(now) {
+				continue
+			}
+			due = append(due, j)
+			if sched, err := cron.Parse(j.Schedule); err == nil {
+				s.next[j.ID] = sched.Next(now)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, j := range due {
+			go s.run(j, false)
+		}
+	}
+}
+
+// run executes a job with its retry policy unless it is already running
+func (s *Scheduler) run(j Job, manual bool) {
+	s.mu.Lock()
+	if s.running[j.ID] {
+		s.mu.Unlock()
+		logger.Warn("Scheduler: job %q is still running, skipped", j.Name)
+		return
+	}
+	s.running[j.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, j.ID)
+		s.mu.Unlock()
+	}()
+
+	timeout := j.Timeout.Std()
+	if timeout <= 0 {
+		timeout = conf.FanOut.Timeout.Std()
+	}
+
+	for attempt := 1; attempt <= j.Retries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(j.RetryDelay.Std())
+		}
+		run := JobRun{JobID: j.ID, Started: time.Now(), Attempt: attempt, ExitCode: -1, Manual: manual}
+
+		info, err := loadSavedHost(j.Host)
+		if err != nil {
+			run.Error = fmt.Sprintf("failed to load saved host: %v", err)
+		} else {
+			res := runOnSavedHost(context.Background(), &info, j.Command, timeout, maxJobOutput)
+			run.ExitCode = res.ExitCode
+			run.Stdout = res.Stdout
+			run.Stderr = res.Stderr
+			run.Error = res.Error
+		}
+		run.DurationMs = time.Since(run.Started).Milliseconds()
+
+		if err := appendJobHistory(run); err != nil {
+			logger.Err("Scheduler: failed to save history of %q: %v", j.Name, err)
+		}
+		if run.Error == "" && run.ExitCode == 0 {
+			logger.Info("Scheduler: job %q succeeded (attempt %d)", j.Name, attempt)
+			return
+		}
+		logger.Warn("Scheduler: job %q failed (attempt %d, exit %d): %s", j.Name, attempt, run.ExitCode, run.Error)
+	}
+}
+
+var historyMu sync.Mutex
+
+func appendJobHistory(run JobRun) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	p, err := jobHistoryPath(run.JobID)
+	if err != nil {
+		return err
+	}
+	var runs []JobRun
+	if err := readJSONFile(p, &runs); err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > maxJobHistory {
+		runs = runs[len(runs)-maxJobHistory:]
+	}
+	return writeJSONFile(p, runs)
+}
+
+func loadJobHistory(id string) ([]JobRun, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	p, err := jobHistoryPath(id)
+	if err != nil {
+		return nil, err
+	}
+	runs := []JobRun{}
+	if err := readJSONFile(p, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// update applies fn to the job list, saves it and reschedules
+func (s *Scheduler) update(fn func(jobs []Job) ([]Job, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs, err := fn(append([]Job(nil), s.jobs...))
+	if err != nil {
+		return err
+	}
+	p, err := jobsPath()
+	if err != nil {
+		return err
+	}
+	if err := writeJSONFile(p, jobs); err != nil {
+		return err
+	}
+	s.jobs = jobs
+	s.reschedule(time.Now())
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) find(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j, true
+		}
+	}
+	return Job{}, false
+}
+
+func jobsPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/jobs accessed")
+	renderTemplate(w, r, "jobs", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func jobListHandler(w http.ResponseWriter, r *http.Request) {
+	type jobView struct {
+		Job
+		NextRun *time.Time `json:"next_run,omitempty"`
+		Running bool       `json:"running"`
+		LastRun *JobRun    `json:"last_run,omitempty"`
+	}
+
+	scheduler.mu.Lock()
+	views := []jobView{}
+	for _, j := range scheduler.jobs {
+		v := jobView{Job: j, Running: scheduler.running[j.ID]}
+		if t, ok := scheduler.next[j.ID]; ok {
+			v.NextRun = &t
+		}
+		views = append(views, v)
+	}
+	scheduler.mu.Unlock()
+
+	for i := range views {
+		if runs, err := loadJobHistory(views[i].ID); err == nil && len(runs) > 0 {
+			views[i].LastRun = &runs[len(runs)-1]
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	writeJSON(w, views)
+}
+
+func jobSaveHandler(w http.ResponseWriter, r *http.Request) {
+	var j Job
+	if !decodeJSONPost(w, r, &j) {
+		return
+	}
+	j.Name = strings.TrimSpace(j.Name)
+	j.Command = strings.TrimSpace(j.Command)
+	if j.Name == "" || j.Command == "" || j.Host == "" {
+		writeJSONError(w, http.StatusBadRequest, "Name, host and command are required")
+		return
+	}
+	if _, err := cron.Parse(j.Schedule); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := loadSavedHost(j.Host); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Unknown saved host: "+j.Host)
+		return
+	}
+	if j.Retries < 0 {
+		j.Retries = 0
+	}
+
+	err := scheduler.update(func(jobs []Job) ([]Job, error) {
+		if j.ID == "" {
+			j.ID = uuid.New().String()
+			return append(jobs, j), nil
+		}
+		for i := range jobs {
+			if jobs[i].ID == j.ID {
+				jobs[i] = j
+				return jobs, nil
+			}
+		}
+		return nil, errors.New("job not found")
+	})
+	if err != nil {
+		logger.Err("Failed to save job %q: %v", j.Name, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save job")
+		return
+	}
+	logger.Info("Job saved (%s): %s [%s] on %s", authFromContext(r).UserHost(), j.Name, j.Schedule, j.Host)
+	writeJSON(w, j)
+}
+
+func jobDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	removed := false
+	err := scheduler.update(func(jobs []Job) ([]Job, error) {
+		kept := jobs[:0]
+		for _, j := range jobs {
+			if j.ID == req.ID {
+				removed = true
+				continue
+			}
+			kept = append(kept, j)
+		}
+		return kept, nil
+	})
+	if err != nil {
+		logger.Err("Failed to delete job: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to delete job")
+		return
+	}
+	if !removed {
+		writeJSONError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	// 実際に削除したジョブの履歴だけを消す
+	if p, err := jobHistoryPath(req.ID); err == nil {
+		os.Remove(p)
+	}
+	writeJSON(w, map[string]string{"status": "deleted"})
+}
+
+func jobRunNowHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	j, ok := scheduler.find(req.ID)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	logger.Info("Job %q started manually by %s", j.Name, authFromContext(r).UserHost())
+	go scheduler.run(j, true)
+	writeJSON(w, map[string]string{"status": "started"})
+}
+
+func jobHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if _, ok := scheduler.find(id); !ok {
+		writeJSONError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	runs, err := loadJobHistory(id)
+	if err != nil {
+		logger.Err("Failed to load job history: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load history")
+		return
+	}
+	// 新しい順
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Started.After(runs[j].Started)
+	})
+	writeJSON(w, runs)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJobHistoryPath(t *testing.T) {
+	valid := "2f1c7b8e-3d4a-4f5b-9c6d-7e8f9a0b1c2d"
+	p, err := jobHistoryPath(valid)
+	if err != nil {
+		t.Fatalf("jobHistoryPath(%q): %v", valid, err)
+	}
+	if filepath.Base(p) != valid+".json" || filepath.Base(filepath.Dir(p)) != "jobs" {
+		t.Errorf("jobHistoryPath(%q) = %q", valid, p)
+	}
+
+	for _, id := range []string{
+		"",
+		"../jobs",
+		"../../.ssh/authorized_keys",
+		"a/b",
+		`a\b`,
+		"..",
+		"2f1c7b8e3d4a4f5b9c6d7e8f9a0b1c2d",
+		"{2f1c7b8e-3d4a-4f5b-9c6d-7e8f9a0b1c2d}",
+		"urn:uuid:2f1c7b8e-3d4a-4f5b-9c6d-7e8f9a0b1c2d",
+	} {
+		if _, err := jobHistoryPath(id); err == nil {
+			t.Errorf("jobHistoryPath(%q) succeeded, want error", id)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// 検索結果の件数の既定値と上限
+const (
+	searchDefaultLimit = 500
+	searchMaxLimit     = 5000
+)
+
+// SearchResult is a file found by the drive search, sent as one line of NDJSON
+type SearchResult struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Size  int64  `json:"size"`
+	Mtime int64  `json:"mtime"`
+}
+
+// searchEnd is the last line of a search response
+type searchEnd struct {
+	Done      bool   `json:"done"`
+	Count     int    `json:"count"`
+	Truncated bool   `json:"truncated"`
+	Error     string `json:"error,omitempty"`
+}
+
+// searchQuery holds the parsed search filters
+type searchQuery struct {
+	Name    string
+	Regex   *regexp.Regexp
+	Type    string
+	MinSize int64
+	MaxSize int64
+	After   string
+	Before  string
+	Content string
+	Limit   int
+}
+
+var searchTypes = map[string]string{
+	"":       "",
+	"file":   "f",
+	"folder": "d",
+	"link":   "l",
+}
+
+// parseSize parses a size such as "1500", "10K", "2.5M", "1 GB" or "1G"
+func parseSize(in string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(in))
+	if s == "" {
+		return -1, nil
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(s, "B"))
+	if s == "" {
+		return 0, fmt.Errorf("invalid size: %q", in)
+	}
+	mult := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1 << 10
+	case 'M':
+		mult = 1 << 20
+	case 'G':
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = strings.TrimSpace(s[:len(s)-1])
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid size: %q", in)
+	}
+	return int64(n * mult), nil
+}
+
+func parseSearchQuery(q url.Values) (*searchQuery, error) {
+	sq := &searchQuery{
+		Name:    q.Get("name"),
+		Content: q.Get("content"),
+		Limit:   searchDefaultLimit,
+	}
+	if q.Get("regex") == "1" && sq.Name != "" {
+		re, err := regexp.Compile("(?i)" + sq.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %v", err)
+		}
+		sq.Regex = re
+	}
+
+	typ, ok := searchTypes[q.Get("type")]
+	if !ok {
+		return nil, fmt.Errorf("invalid type: %q", q.Get("type"))
+	}
+	sq.Type = typ
+
+	var err error
+	if sq.MinSize, err = parseSize(q.Get("min_size")); err != nil {
+		return nil, err
+	}
+	if sq.MaxSize, err = parseSize(q.Get("max_size")); err != nil {
+		return nil, err
+	}
+
+	for _, d := range []struct {
+		key string
+		dst *string
+	}{{"after", &sq.After}, {"before", &sq.Before}} {
+		if v := q.Get(d.key); v != "" {
+			if _, err := time.Parse(time.DateOnly, v); err != nil {
+				return nil, fmt.Errorf("invalid date for %s: %q", d.key, v)
+			}
+			*d.dst = v
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid limit: %q", v)
+		}
+		sq.Limit = min(n, searchMaxLimit)
+	}
+	return sq, nil
+}
+
+// findArgs builds the find command for the query. Name globs, sizes,
+// dates and types are filtered by find; name regexes are applied by the
+// caller so that Go's syntax is used. Lines are "type\tsize\tmtime\tpath".
+func (sq *searchQuery) findArgs(abs string) []string {
+	argv := []string{"find", "-H", abs, "-mindepth", "1"}
+	if sq.Name != "" && sq.Regex == nil {
+		glob := sq.Name
+		if !strings.ContainsAny(glob, "*?[") {
+			// ワイルドカードがなければ部分一致にする
+			glob = "*" + glob + "*"
+		}
+		argv = append(argv, "-iname", glob)
+	}
+	if sq.Content != "" {
+		argv = append(argv, "-type", "f")
+	} else if sq.Type != "" {
+		argv = append(argv, "-type", sq.Type)
+	}
+	if sq.MinSize > 0 {
+		argv = append(argv, "-size", "+"+strconv.FormatInt(sq.MinSize-1, 10)+"c")
+	}
+	if sq.MaxSize >= 0 {
+		argv = append(argv, "-size", "-"+strconv.FormatInt(sq.MaxSize+1, 10)+"c")
+	}
+	if sq.After != "" {
+		argv = append(argv, "-newermt", sq.After)
+	}
+	if sq.Before != "" {
+		argv = append(argv, "!", "-newermt", sq.Before)
+	}
+	if sq.Content != "" {
+		// バイナリファイルは除外し、固定文字列として大文字小文字を区別せず探す
+		argv = append(argv, "-exec", "grep", "-qIsiF", "-e", sq.Content, "--", "{}", ";")
+	}
+	return append(argv, "-printf", `%y\t%s\t%T@\t%p\n`)
+}
+
+// parseSearchLine parses a line of find output, returning the result and its absolute path
+func parseSearchLine(line string) (*SearchResult, string, bool) {
+	f := strings.SplitN(line, "\t", 4)
+	if len(f) < 4 {
+		return nil, "", false
+	}
+	res := &SearchResult{Name: path.Base(f[3])}
+	switch f[0] {
+	case "f":
+		res.Type = "file"
+	case "d":
+		res.Type = "folder"
+	case "l":
+		res.Type = "link"
+	default:
+		res.Type = "other"
+	}
+	res.Size, _ = strconv.ParseInt(f[1], 10, 64)
+	mtime, _ := strconv.ParseFloat(f[2], 64)
+	res.Mtime = int64(mtime)
+	return res, f[3], true
+}
+
+// driveSearchHandler searches below a folder of the drive and streams the
+// results as NDJSON. The search stops when the limit is reached or the
+// client goes away.
+// Query: path, name, regex (1), type, min_size, max_size, after, before, content, limit
+func driveSearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sq, err := parseSearchQuery(q)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	auth := authFromContext(r)
+	root, abs, ok := requestPath(w, r, q.Get("path"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+
+	end := runSearch(r.Context(), auth.Client, sq, abs, func(res *SearchResult, p string) {
+		res.Path = relativePath(root, p)
+		enc.Encode(res)
+		rc.Flush()
+	})
+	enc.Encode(end)
+	logger.Info("Drive search (%s) in %s: %d results", auth.UserHost(), abs, end.Count)
+}
+
+// runSearch runs find and calls emit for every match until the limit is
+// reached or ctx is done. Calls to emit are serialized.
+func runSearch(ctx context.Context, client *ssh.Client, sq *searchQuery, abs string, emit func(*SearchResult, string)) searchEnd {
+	var (
+		mu  sync.Mutex
+		end = searchEnd{Done: true}
+		p   *command.Process
+	)
+	proc, err := command.Start(client, sq.findArgs(abs), func(stream, line string) {
+		if stream != command.Stdout {
+			// 権限のないディレクトリなどのエラーは無視する
+			return
+		}
+		res, full, ok := parseSearchLine(line)
+		if !ok {
+			return
+		}
+		if sq.Regex != nil && !sq.Regex.MatchString(res.Name) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if end.Count >= sq.Limit {
+			if !end.Truncated {
+				end.Truncated = true
+				if p != nil {
+					p.Close()
+				}
+			}
+			return
+		}
+		end.Count++
+		emit(res, full)
+	})
+	if err != nil {
+		end.Error = err.Error()
+		return end
+	}
+	mu.Lock()
+	p = proc
+	if end.Truncated {
+		proc.Close()
+	}
+	mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		proc.Signal(ssh.SIGKILL)
+		proc.Close()
+	})
+	defer stop()
+	proc.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if ctx.Err() != nil {
+		end.Error = "search cancelled"
+	}
+	return end
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", -1, false},
+		{"  ", -1, false},
+		{"0", 0, false},
+		{"1500", 1500, false},
+		{"10K", 10 << 10, false},
+		{"10k", 10 << 10, false},
+		{"10KB", 10 << 10, false},
+		{"2.5M", 2.5 * (1 << 20), false},
+		{"1G", 1 << 30, false},
+		{" 3 M ", 3 << 20, false},
+		{"1 GB", 1 << 30, false},
+		{"B", 0, true},
+		{"NaN", 0, true},
+		{"inf", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+		{"1T", 0, true},
+		{"K", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	valid := []string{
+		"name=*.go",
+		"name=^main&regex=1",
+		"type=folder&min_size=1K&max_size=2M",
+		"after=2024-01-01&before=2024-12-31",
+		"limit=999999",
+	}
+	for _, q := range valid {
+		v, _ := url.ParseQuery(q)
+		if _, err := parseSearchQuery(v); err != nil {
+			t.Errorf("parseSearchQuery(%q): %v", q, err)
+		}
+	}
+	invalid := []string{
+		"name=(&regex=1",
+		"type=socket",
+		"min_size=big",
+		"after=01/02/2024",
+		"limit=0",
+		"limit=x",
+	}
+	for _, q := range invalid {
+		v, _ := url.ParseQuery(q)
+		if _, err := parseSearchQuery(v); err == nil {
+			t.Errorf("parseSearchQuery(%q) succeeded, want error", q)
+		}
+	}
+
+	v, _ := url.ParseQuery("limit=999999")
+	if sq, _ := parseSearchQuery(v); sq.Limit != searchMaxLimit {
+		t.Errorf("limit = %d, want %d", sq.Limit, searchMaxLimit)
+	}
+}
+
+func TestParseSearchLine(t *testing.T) {
+	res, p, ok := parseSearchLine("f\t1234\t1700000000.5\t/home/u/a b\tc.txt")
+	if !ok {
+		t.Fatal("parseSearchLine failed")
+	}
+	if p != "/home/u/a b\tc.txt" || res.Name != "a b\tc.txt" || res.Type != "file" || res.Size != 1234 || res.Mtime != 1700000000 {
+		t.Errorf("parseSearchLine = %+v, %q", res, p)
+	}
+	if _, _, ok := parseSearchLine("f\t12"); ok {
+		t.Error("short line accepted")
+	}
+}
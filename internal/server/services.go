@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"github.com/rxxuzi/tune/internal/systemd"
+)
+
+func RegisterServiceHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/services", requireAuth(servicesPageHandler))
+	mux.HandleFunc("/services/journal", requireAuth(journalPageHandler))
+	mux.HandleFunc("/services/journal/ws", requireAuth(journalWSHandler))
+	mux.HandleFunc("/api/services", requireAuth(serviceListHandler))
+	mux.HandleFunc("/api/services/action", requireAuth(serviceActionHandler))
+}
+
+func servicesPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/services accessed")
+	auth := authFromContext(r)
+	renderTemplate(w, r, "services", struct {
+		UserHost string
+		Sudo     bool
+	}{
+		UserHost: auth.UserHost(),
+		Sudo:     conf.Profile(auth.Host).Sudo,
+	})
+}
+
+func serviceListHandler(w http.ResponseWriter, r *http.Request) {
+	client := authFromContext(r).Client
+
+	// JSON 出力に対応していない systemd ではテキストを解析する
+	var units []systemd.Unit
+	out, err := command.Output(r.Context(), client, systemd.ListUnitsJSONArgs...)
+	if err == nil {
+		units, err = systemd.ParseUnitsJSON(out)
+	}
+	if err != nil {
+		logger.Debug("systemctl --output=json unavailable, falling back to text: %v", err)
+		out, err = command.Output(r.Context(), client, systemd.ListUnitsArgs...)
+		if err != nil {
+			logger.Err("Failed to list systemd units: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to list units (is systemd running?)")
+			return
+		}
+		units = systemd.ParseUnits(out)
+	}
+
+	states := map[string]string{}
+	if out, err := command.Output(r.Context(), client, systemd.ListUnitFilesArgs...); err == nil {
+		states = systemd.ParseUnitFiles(out)
+	} else {
+		logger.Warn("Failed to list unit files: %v", err)
+	}
+
+	writeJSON(w, systemd.Merge(units, states))
+}
+
+func serviceActionHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Unit   string `json:"unit"`
+		Action string `json:"action"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if !systemd.Actions[req.Action] {
+		writeJSONError(w, http.StatusBadRequest, "Unsupported action: "+req.Action)
+		return
+	}
+	if !systemd.ValidName(req.Unit) {
+		writeJSONError(w, http.StatusBadRequest, "Invalid unit name")
+		return
+	}
+	auth := authFromContext(r)
+
+	argv := privileged(auth.Host, "systemctl", req.Action, "--", req.Unit)
+	res, err := command.Run(r.Context(), auth.Client, argv...)
+	if err != nil {
+		logger.Err("Service %s %s failed (%s): %v", req.Action, req.Unit, auth.UserHost(), err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to run systemctl")
+		return
+	}
+	if res.ExitCode != 0 {
+		msg := strings.TrimSpace(res.Stderr)
+		logger.Warn("Service %s %s exited with %d (%s): %s", req.Action, req.Unit, res.ExitCode, auth.UserHost(), msg)
+		if strings.Contains(msg, "sudo") && strings.Contains(msg, "password") {
+			msg = "sudo requires a password; configure passwordless sudo for systemctl"
+		}
+		writeJSONError(w, http.StatusBadGateway, msg)
+		return
+	}
+	logger.Info("Service %s %s by %s", req.Action, req.Unit, auth.UserHost())
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+func journalPageHandler(w http.ResponseWriter, r *http.Request) {
+	unit := r.URL.Query().Get("unit")
+	renderTemplate(w, r, "tail", followPageData{
+		UserHost: authFromContext(r).UserHost(),
+		Title:    "journal: " + unit,
+		Source:   "/services/journal/ws?unit=" + url.QueryEscape(unit),
+	})
+}
+
+func journalWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	q := r.URL.Query()
+
+	unit := q.Get("unit")
+	if !systemd.ValidName(unit) {
+		writeJSONError(w, http.StatusBadRequest, "Invalid unit name")
+		return
+	}
+	lines := tailDefaultLines
+	if n, err := strconv.Atoi(q.Get("lines")); err == nil && n >= 0 {
+		lines = min(n, tailMaxLines)
+	}
+
+	argv := privileged(auth.Host, "journalctl", "--no-pager", "-o", "short-iso", "-n", strconv.Itoa(lines), "-f", "-u", unit)
+	logger.Info("Journal (%s): %s", auth.UserHost(), unit)
+	followLines(w, r, argv, "journalctl -u "+unit)
+}
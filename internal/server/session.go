@@ -6,7 +6,14 @@ import (
 	"github.com/gorilla/sessions"
 )
 
-var store = sessions.NewCookieStore([]byte("secret-key"))
+var store = newCookieStore()
+
+func newCookieStore() *sessions.CookieStore {
+	s := sessions.NewCookieStore([]byte("secret-key"))
+	// Cookie はポートを区別しないため、別ポートで配信するプロキシ先のアプリから読ませない
+	s.Options.HttpOnly = true
+	return s
+}
 
 // セッション名
 const sessionName = "tune-session"
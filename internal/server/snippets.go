@@ -0,0 +1,452 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/config"
+	"github.com/rxxuzi/tune/internal/logger"
+)
+
+// Snippet is a saved command template such as "systemctl status {{service}}"
+type Snippet struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Command     string `json:"command"`
+}
+
+// RunbookStep is a single command of a runbook
+type RunbookStep struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+// Runbook is a sequence of command templates run in order
+type Runbook struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Steps       []RunbookStep `json:"steps"`
+}
+
+// SnippetLibrary is the content of ~/.tune/snippets.json
+type SnippetLibrary struct {
+	Snippets []Snippet `json:"snippets"`
+	Runbooks []Runbook `json:"runbooks"`
+}
+
+// StepResult is the outcome of a runbook step
+type StepResult struct {
+	Name       string `json:"name"`
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	DurationMs int64  `json:"duration_ms"`
+	Skipped    bool   `json:"skipped"`
+	Error      string `json:"error,omitempty"`
+}
+
+// テンプレート変数: {{service}}
+var templateVar = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+var snippetMu sync.Mutex
+
+func RegisterSnippetHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/snippets", requireAuth(snippetsPageHandler))
+	mux.HandleFunc("/api/snippets", requireAuth(snippetListHandler))
+	mux.HandleFunc("/api/snippets/save", requireAuth(snippetSaveHandler))
+	mux.HandleFunc("/api/snippets/delete", requireAuth(snippetDeleteHandler))
+	mux.HandleFunc("/api/snippets/render", requireAuth(snippetRenderHandler))
+	mux.HandleFunc("/api/snippets/run", requireAuth(snippetRunHandler))
+	mux.HandleFunc("/api/runbooks/run", requireAuth(runbookRunHandler))
+}
+
+func snippetsPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snippets.json"), nil
+}
+
+// loadSnippets reads the snippet library. A missing file is an empty library.
+func loadSnippets() (*SnippetLibrary, error) {
+	p, err := snippetsPath()
+	if err != nil {
+		return nil, err
+	}
+	lib := &SnippetLibrary{Snippets: []Snippet{}, Runbooks: []Runbook{}}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lib, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lib); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return lib, nil
+}
+
+func saveSnippets(lib *SnippetLibrary) error {
+	p, err := snippetsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lib, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+// templateVariables returns the variable names used in the templates, in order of appearance
+func templateVariables(templates ...string) []string {
+	seen := map[string]bool{}
+	vars := []string{}
+	for _, t := range templates {
+		for _, m := range templateVar.FindAllStringSubmatch(t, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				vars = append(vars, m[1])
+			}
+		}
+	}
+	return vars
+}
+
+// renderTemplateCommand substitutes variables with shell-quoted values.
+// Values may not contain control characters: a newline or escape sequence
+// typed into a terminal would run the command before the user confirms it.
+func renderTemplateCommand(tmpl string, vars map[string]string) (string, error) {
+	for name, v := range vars {
+		if strings.IndexFunc(v, func(r rune) bool { return r != '\t' && unicode.IsControl(r) }) >= 0 {
+			return "", fmt.Errorf("variable %s contains control characters", name)
+		}
+	}
+	var missing []string
+	out := templateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := templateVar.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+			return m
+		}
+		return command.Quote(v)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing variables: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func findSnippet(lib *SnippetLibrary, name string) *Snippet {
+	for i := range lib.Snippets {
+		if lib.Snippets[i].Name == name {
+			return &lib.Snippets[i]
+		}
+	}
+	return nil
+}
+
+func findRunbook(lib *SnippetLibrary, name string) *Runbook {
+	for i := range lib.Runbooks {
+		if lib.Runbooks[i].Name == name {
+			return &lib.Runbooks[i]
+		}
+	}
+	return nil
+}
+
+func snippetsPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/snippets accessed")
+	renderTemplate(w, r, "snippets", struct {
+		UserHost string
+	}{
+		UserHost: authFromContext(r).UserHost(),
+	})
+}
+
+func snippetListHandler(w http.ResponseWriter, r *http.Request) {
+	snippetMu.Lock()
+	lib, err := loadSnippets()
+	snippetMu.Unlock()
+	if err != nil {
+		logger.Err("Failed to load snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load snippets")
+		return
+	}
+
+	type snippetView struct {
+		Snippet
+		Variables []string `json:"variables"`
+	}
+	type runbookView struct {
+		Runbook
+		Variables []string `json:"variables"`
+	}
+	resp := struct {
+		Snippets []snippetView `json:"snippets"`
+		Runbooks []runbookView `json:"runbooks"`
+	}{
+		Snippets: []snippetView{},
+		Runbooks: []runbookView{},
+	}
+	for _, s := range lib.Snippets {
+		resp.Snippets = append(resp.Snippets, snippetView{s, templateVariables(s.Command)})
+	}
+	for _, rb := range lib.Runbooks {
+		var cmds []string
+		for _, st := range rb.Steps {
+			cmds = append(cmds, st.Command)
+		}
+		resp.Runbooks = append(resp.Runbooks, runbookView{rb, templateVariables(cmds...)})
+	}
+	writeJSON(w, resp)
+}
+
+func snippetSaveHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Snippet *Snippet `json:"snippet"`
+		Runbook *Runbook `json:"runbook"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	snippetMu.Lock()
+	defer snippetMu.Unlock()
+	lib, err := loadSnippets()
+	if err != nil {
+		logger.Err("Failed to load snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load snippets")
+		return
+	}
+
+	switch {
+	case req.Snippet != nil:
+		s := *req.Snippet
+		if strings.TrimSpace(s.Name) == "" || strings.TrimSpace(s.Command) == "" {
+			writeJSONError(w, http.StatusBadRequest, "Name and command are required")
+			return
+		}
+		if existing := findSnippet(lib, s.Name); existing != nil {
+			*existing = s
+		} else {
+			lib.Snippets = append(lib.Snippets, s)
+		}
+	case req.Runbook != nil:
+		rb := *req.Runbook
+		if strings.TrimSpace(rb.Name) == "" || len(rb.Steps) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "Name and at least one step are required")
+			return
+		}
+		for _, st := range rb.Steps {
+			if strings.TrimSpace(st.Command) == "" {
+				writeJSONError(w, http.StatusBadRequest, "Every step needs a command")
+				return
+			}
+		}
+		if existing := findRunbook(lib, rb.Name); existing != nil {
+			*existing = rb
+		} else {
+			lib.Runbooks = append(lib.Runbooks, rb)
+		}
+	default:
+		writeJSONError(w, http.StatusBadRequest, "Nothing to save")
+		return
+	}
+
+	if err := saveSnippets(lib); err != nil {
+		logger.Err("Failed to save snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save snippets")
+		return
+	}
+	writeJSON(w, map[string]string{"status": "saved"})
+}
+
+func snippetDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	snippetMu.Lock()
+	defer snippetMu.Unlock()
+	lib, err := loadSnippets()
+	if err != nil {
+		logger.Err("Failed to load snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load snippets")
+		return
+	}
+
+	switch req.Kind {
+	case "runbook":
+		kept := lib.Runbooks[:0]
+		for _, rb := range lib.Runbooks {
+			if rb.Name != req.Name {
+				kept = append(kept, rb)
+			}
+		}
+		lib.Runbooks = kept
+	default:
+		kept := lib.Snippets[:0]
+		for _, s := range lib.Snippets {
+			if s.Name != req.Name {
+				kept = append(kept, s)
+			}
+		}
+		lib.Snippets = kept
+	}
+
+	if err := saveSnippets(lib); err != nil {
+		logger.Err("Failed to save snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to save snippets")
+		return
+	}
+	writeJSON(w, map[string]string{"status": "deleted"})
+}
+
+type snippetInvocation struct {
+	Name string            `json:"name"`
+	Vars map[string]string `json:"vars"`
+}
+
+// renderSnippet looks up a snippet and renders its command, writing a JSON error on failure
+func renderSnippet(w http.ResponseWriter, req snippetInvocation) (string, bool) {
+	snippetMu.Lock()
+	lib, err := loadSnippets()
+	snippetMu.Unlock()
+	if err != nil {
+		logger.Err("Failed to load snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load snippets")
+		return "", false
+	}
+	s := findSnippet(lib, req.Name)
+	if s == nil {
+		writeJSONError(w, http.StatusNotFound, "Snippet not found")
+		return "", false
+	}
+	cmd, err := renderTemplateCommand(s.Command, req.Vars)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return cmd, true
+}
+
+func snippetRenderHandler(w http.ResponseWriter, r *http.Request) {
+	var req snippetInvocation
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	cmd, ok := renderSnippet(w, req)
+	if !ok {
+		return
+	}
+	writeJSON(w, map[string]string{"command": cmd})
+}
+
+func snippetRunHandler(w http.ResponseWriter, r *http.Request) {
+	var req snippetInvocation
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	cmd, ok := renderSnippet(w, req)
+	if !ok {
+		return
+	}
+
+	auth := authFromContext(r)
+	logger.Info("Snippet %q (%s): %s", req.Name, auth.UserHost(), cmd)
+	result, err := command.RunShell(r.Context(), auth.Client, cmd)
+	if err != nil {
+		logger.Err("Failed to run snippet %q: %v", req.Name, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to run snippet")
+		return
+	}
+	writeJSON(w, struct {
+		Command string `json:"command"`
+		*command.Result
+	}{cmd, result})
+}
+
+func runbookRunHandler(w http.ResponseWriter, r *http.Request) {
+	var req snippetInvocation
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	snippetMu.Lock()
+	lib, err := loadSnippets()
+	snippetMu.Unlock()
+	if err != nil {
+		logger.Err("Failed to load snippets: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load snippets")
+		return
+	}
+	rb := findRunbook(lib, req.Name)
+	if rb == nil {
+		writeJSONError(w, http.StatusNotFound, "Runbook not found")
+		return
+	}
+
+	// 全ステップを先にレンダリングし、変数の不足は実行前に検出する
+	cmds := make([]string, len(rb.Steps))
+	for i, st := range rb.Steps {
+		if cmds[i], err = renderTemplateCommand(st.Command, req.Vars); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	auth := authFromContext(r)
+	logger.Info("Runbook %q (%s): %d steps", rb.Name, auth.UserHost(), len(rb.Steps))
+	results := make([]StepResult, len(rb.Steps))
+	failed := false
+	for i, st := range rb.Steps {
+		results[i] = StepResult{Name: st.Name, Command: cmds[i], ExitCode: -1}
+		if failed {
+			results[i].Skipped = true
+			continue
+		}
+		start := time.Now()
+		out, err := command.RunShell(r.Context(), auth.Client, cmds[i])
+		results[i].DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			results[i].Error = err.Error()
+			failed = true
+			continue
+		}
+		results[i].ExitCode = out.ExitCode
+		results[i].Stdout = out.Stdout
+		results[i].Stderr = out.Stderr
+		if out.ExitCode != 0 {
+			logger.Warn("Runbook %q stopped at step %d (exit %d)", rb.Name, i+1, out.ExitCode)
+			failed = true
+		}
+	}
+
+	writeJSON(w, struct {
+		Name  string       `json:"name"`
+		OK    bool         `json:"ok"`
+		Steps []StepResult `json:"steps"`
+	}{rb.Name, !failed, results})
+}
@@ -0,0 +1,34 @@
+package server
+
+import "testing"
+
+func TestRenderTemplateCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		vars    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "uptime", nil, "uptime", false},
+		{"simple var", "systemctl status {{service}}", map[string]string{"service": "nginx"}, "systemctl status nginx", false},
+		{"spaces in braces", "tail -n {{ n }} {{file}}", map[string]string{"n": "20", "file": "/var/log/syslog"}, "tail -n 20 /var/log/syslog", false},
+		{"quoted value", "grep {{pattern}} log", map[string]string{"pattern": "a b; rm -rf /"}, "grep 'a b; rm -rf /' log", false},
+		{"missing var", "echo {{x}}", map[string]string{}, "", true},
+		{"newline", "echo {{x}}", map[string]string{"x": "a\nreboot"}, "", true},
+		{"carriage return", "echo {{x}}", map[string]string{"x": "a\r"}, "", true},
+		{"escape sequence", "echo {{x}}", map[string]string{"x": "\x1b[201~reboot"}, "", true},
+		{"tab allowed", "echo {{x}}", map[string]string{"x": "a\tb"}, "echo 'a\tb'", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplateCommand(tt.tmpl, tt.vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
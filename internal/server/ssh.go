@@ -5,27 +5,33 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
 type SSHInfo struct {
-	Host     string `json:"host"`
-	User     string `json:"user"`
-	Port     int    `json:"port"`
-	Password string `json:"password"`
+	Host     string   `json:"host"`
+	User     string   `json:"user"`
+	Port     int      `json:"port"`
+	Password string   `json:"password"`
+	Tags     []string `json:"tags,omitempty"`
 }
 
 func (info *SSHInfo) Address() string {
 	return fmt.Sprintf("%s:%d", info.Host, info.Port)
 }
 
-func connectSSH(info *SSHInfo) (*ssh.Client, error) {
+// connectSSH connects to the host. If ip is set it is dialed instead of
+// resolving the host name, which is still used for the host key.
+func connectSSH(info *SSHInfo, ip net.IP) (*ssh.Client, error) {
 	config := &ssh.ClientConfig{
 		User: info.User,
 		Auth: []ssh.AuthMethod{
@@ -34,7 +40,19 @@ func connectSSH(info *SSHInfo) (*ssh.Client, error) {
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 		Timeout:         10 * time.Second,
 	}
-	return ssh.Dial("tcp", info.Address(), config)
+	if ip == nil {
+		return ssh.Dial("tcp", info.Address(), config)
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(info.Port)), config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, info.Address(), config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 func defaultVerifyDir() (string, error) {
@@ -81,6 +99,31 @@ func loadSavedHosts() ([]SSHInfo, error) {
 	return hosts, nil
 }
 
+// loadSavedHost reads the saved connection for host from the verify directory
+func loadSavedHost(host string) (SSHInfo, error) {
+	if host == "" || strings.ContainsAny(host, "/\\") || strings.Contains(host, "..") {
+		return SSHInfo{}, fmt.Errorf("invalid host name: %q", host)
+	}
+	dir, err := defaultVerifyDir()
+	if err != nil {
+		return SSHInfo{}, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("ssh-%s.json", host)))
+	if err != nil {
+		return SSHInfo{}, err
+	}
+	return parseSSHInfoJSON(data)
+}
+
+// dialHost connects to a host after checking it against the host policy
+func dialHost(info *SSHInfo) (*ssh.Client, error) {
+	ip, err := hostPolicy.Check(info.Host)
+	if err != nil {
+		return nil, err
+	}
+	return connectSSH(info, ip)
+}
+
 func parseSSHInfoJSON(data []byte) (SSHInfo, error) {
 	info, err := parseJSONToSSHInfo(data)
 	if err != nil {
@@ -10,12 +10,14 @@ import (
 type SSHManager struct {
 	mu      sync.RWMutex
 	clients map[string]*ssh.Client
+	roots   map[string]string
 }
 
 // NewSSHManager creates a new SSHManager
 func NewSSHManager() *SSHManager {
 	return &SSHManager{
 		clients: make(map[string]*ssh.Client),
+		roots:   make(map[string]string),
 	}
 }
 
@@ -35,13 +37,34 @@ func (sm *SSHManager) GetClient(sessionID string) (*ssh.Client, bool) {
 }
 
 // RemoveClient removes the SSH client associated with the given session ID
+// and closes the port forwards and proxy connections opened through it
 func (sm *SSHManager) RemoveClient(sessionID string) {
+	forwards.CloseSession(sessionID)
+	closeProxyTransport(sessionID)
+	stopMonitor(sessionID)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	if client, exists := sm.clients[sessionID]; exists {
 		client.Close()
 		delete(sm.clients, sessionID)
 	}
+	delete(sm.roots, sessionID)
+}
+
+// SetRoot stores the resolved drive root for the given session ID
+func (sm *SSHManager) SetRoot(sessionID, root string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.roots[sessionID] = root
+}
+
+// GetRoot retrieves the resolved drive root for the given session ID
+func (sm *SSHManager) GetRoot(sessionID string) (string, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	root, exists := sm.roots[sessionID]
+	return root, exists
 }
 
 var sshManager = NewSSHManager()
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// tailMessage is a message exchanged on /tail/ws.
+// Client: {"type":"filter","pattern":"...","regex":true} / pause / resume
+// Server: started, line, dropped, error, exit
+type tailMessage struct {
+	Type    string `json:"type"`
+	Pattern string `json:"pattern,omitempty"`
+	Regex   bool   `json:"regex,omitempty"`
+	Stream  string `json:"stream,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Count   int    `json:"count,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	tailDefaultLines = 100
+	tailMaxLines     = 5000
+	// 一時停止中に保持する行数
+	tailPauseBuffer = 1000
+)
+
+var (
+	tailErrorPattern = regexp.MustCompile(`(?i)\b(error|fatal|crit(ical)?|panic|exception)\b`)
+	tailWarnPattern  = regexp.MustCompile(`(?i)\bwarn(ing)?\b`)
+)
+
+func RegisterTailHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/tail", requireAuth(tailPageHandler))
+	mux.HandleFunc("/tail/ws", requireAuth(tailWSHandler))
+}
+
+// followPageData is rendered by tail.html, which follows the lines of Source
+type followPageData struct {
+	UserHost string
+	Title    string
+	Source   string
+}
+
+func tailPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/tail accessed")
+	file := r.URL.Query().Get("file")
+	renderTemplate(w, r, "tail", followPageData{
+		UserHost: authFromContext(r).UserHost(),
+		Title:    path.Base(file),
+		Source:   "/tail/ws?file=" + url.QueryEscape(file),
+	})
+}
+
+// lineLevel classifies a log line as "error", "warn" or ""
+func lineLevel(line string) string {
+	switch {
+	case tailErrorPattern.MatchString(line):
+		return "error"
+	case tailWarnPattern.MatchString(line):
+		return "warn"
+	}
+	return ""
+}
+
+// tailFilter decides which lines are sent to the client
+type tailFilter struct {
+	substr string
+	re     *regexp.Regexp
+}
+
+func newTailFilter(pattern string, isRegex bool) (*tailFilter, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if !isRegex {
+		return &tailFilter{substr: strings.ToLower(pattern)}, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &tailFilter{re: re}, nil
+}
+
+func (f *tailFilter) match(line string) bool {
+	if f == nil {
+		return true
+	}
+	if f.re != nil {
+		return f.re.MatchString(line)
+	}
+	return strings.Contains(strings.ToLower(line), f.substr)
+}
+
+func tailWSHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	q := r.URL.Query()
+
+	file := q.Get("file")
+	if file == "" {
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
+		return
+	}
+	root, absPath, ok := requestPath(w, r, file)
+	if !ok {
+		return
+	}
+	lines := tailDefaultLines
+	if n, err := strconv.Atoi(q.Get("lines")); err == nil && n >= 0 {
+		lines = min(n, tailMaxLines)
+	}
+
+	// -F: ローテーションされても新しいファイルを追い続ける
+	argv := []string{"tail", "-n", strconv.Itoa(lines), "-F", "--", absPath}
+	logger.Info("Tail (%s): %s", auth.UserHost(), absPath)
+	followLines(w, r, argv, "/"+relativePath(root, absPath))
+}
+
+// followLines runs argv and streams its output to a WebSocket. The client
+// can filter lines and pause; lines held while paused are sent on resume.
+func followLines(w http.ResponseWriter, r *http.Request, argv []string, label string) {
+	auth := authFromContext(r)
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Err("Follow: WebSocket upgrade failed: %v", err)
+		return
+	}
+	conn := &wsConn{Conn: ws}
+	defer conn.Close()
+
+	var (
+		mu      sync.Mutex
+		filter  *tailFilter
+		paused  bool
+		pending []tailMessage
+		dropped int
+	)
+
+	proc, err := command.Start(auth.Client, argv, func(stream, line string) {
+		msg := tailMessage{Type: "line", Stream: stream, Data: line}
+		if stream == command.Stdout {
+			msg.Level = lineLevel(line)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		// コマンド自身のメッセージ (ローテーション通知など) は常に送る
+		if stream == command.Stdout && !filter.match(line) {
+			return
+		}
+		if paused {
+			if len(pending) < tailPauseBuffer {
+				pending = append(pending, msg)
+			} else {
+				dropped++
+			}
+			return
+		}
+		conn.WriteJSON(msg)
+	})
+	if err != nil {
+		logger.Err("Follow: failed to start %s: %v", argv[0], err)
+		conn.WriteJSON(tailMessage{Type: "error", Message: "Failed to start " + argv[0]})
+		return
+	}
+	defer func() {
+		proc.Signal(ssh.SIGTERM)
+		proc.Close()
+	}()
+	conn.WriteJSON(tailMessage{Type: "started", Data: label})
+
+	go func() {
+		code, err := proc.Wait()
+		reply := tailMessage{Type: "exit", Code: code}
+		if err != nil {
+			reply.Message = err.Error()
+		}
+		conn.WriteJSON(reply)
+		// コマンドが終了したら接続も閉じる
+		conn.Close()
+	}()
+
+	for {
+		var msg tailMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Warn("Follow: Unexpected client disconnection: %v", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case "filter":
+			f, err := newTailFilter(msg.Pattern, msg.Regex)
+			if err != nil {
+				conn.WriteJSON(tailMessage{Type: "error", Message: "Invalid pattern: " + err.Error()})
+				continue
+			}
+			mu.Lock()
+			filter = f
+			mu.Unlock()
+
+		case "pause":
+			mu.Lock()
+			paused = true
+			mu.Unlock()
+
+		case "resume":
+			mu.Lock()
+			paused = false
+			for _, m := range pending {
+				conn.WriteJSON(m)
+			}
+			if dropped > 0 {
+				conn.WriteJSON(tailMessage{Type: "dropped", Count: dropped})
+			}
+			pending, dropped = nil, 0
+			mu.Unlock()
+
+		default:
+			conn.WriteJSON(tailMessage{Type: "error", Message: "Unknown message type: " + msg.Type})
+		}
+	}
+}
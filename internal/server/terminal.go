@@ -10,93 +10,86 @@ import (
 
 // WebSocket upgrader
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// セキュリティ要件に応じてオリジンをチェック
-		return true
-	},
+	CheckOrigin: checkOrigin,
 }
 
+// terminalPageData is rendered by terminal.html
+type terminalPageData struct {
+	Title  string
+	Socket string
+	// Logout は 'exit' でログアウトするかどうか
+	Logout bool
+}
+
+// terminalWSHandler opens a login shell on the session's host, or on a
+// saved host given by ?host=. The terminal is registered so that it can be
+// grouped for broadcast input.
 func terminalWSHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info("/terminal/ws WebSocket connection request received")
-
-	// セッションの取得
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("WebSocket: Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+	auth := authFromContext(r)
+	name := r.URL.Query().Get("host")
+	if name == "" || name == auth.Host {
+		serveTerminal(w, r, auth.Client, "", auth.UserHost(), true)
 		return
 	}
 
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("WebSocket: session_id not found in session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
+	info, err := loadSavedHost(name)
+	if err != nil {
+		logger.Warn("Terminal: Failed to load saved host %s: %v", name, err)
+		writeJSONError(w, http.StatusNotFound, "Unknown saved host")
 		return
 	}
-
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("WebSocket: SSH connection does not exist")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
+	client, err := dialHost(&info)
+	if err != nil {
+		logger.Warn("Terminal: Connection to %s failed: %v", name, err)
+		writeJSONError(w, http.StatusBadGateway, "Connection to "+name+" failed")
 		return
 	}
+	defer client.Close()
+	serveTerminal(w, r, client, "", info.User+"@"+info.Host, false)
+}
+
+// servePTY connects a WebSocket to cmd running in a PTY, or the login shell
+// if cmd is empty. With logoutOnExit, typing 'exit' also ends the tune session.
+func servePTY(w http.ResponseWriter, r *http.Request, cmd string, logoutOnExit bool) {
+	serveTerminal(w, r, authFromContext(r).Client, cmd, "", logoutOnExit)
+}
+
+// serveTerminal is servePTY on the given client. If title is set the
+// terminal is added to the registry under that title.
+func serveTerminal(w http.ResponseWriter, r *http.Request, client *ssh.Client, cmd, title string, logoutOnExit bool) {
+	sessionID := authFromContext(r).SessionID
 
 	// WebSocket 接続のアップグレード
-	conn, err := upgrader.Upgrade(w, r, nil)
+	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Err("WebSocket: Upgrade failed: %v", err)
 		return
 	}
+	conn := &wsConn{Conn: ws}
 	defer conn.Close()
 
 	logger.Info("WebSocket: Connection established")
 
-	// SSH セッションの作成
-	sshSession, err := client.NewSession()
+	// PTY 付きシェルの起動
+	pty, err := startPTY(client, cmd)
 	if err != nil {
-		logger.Err("WebSocket: Failed to create SSH session: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to create SSH session\n"))
-		return
-	}
-	defer sshSession.Close()
-
-	// PTY のリクエスト（固定サイズ）
-	modes := ssh.TerminalModes{
-		ssh.ECHO:          1,     // エコーを有効にする
-		ssh.TTY_OP_ISPEED: 14400, // 入力速度
-		ssh.TTY_OP_OSPEED: 14400, // 出力速度
-	}
-	cols := 32
-	rows := 120
-	if err := sshSession.RequestPty("xterm", cols, rows, modes); err != nil {
-		logger.Err("WebSocket: PTY request failed: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("PTY request failed\n"))
+		logger.Err("WebSocket: Failed to start shell: %v", err)
+		conn.WriteMessage(websocket.TextMessage, []byte("Failed to start shell\n"))
 		return
 	}
+	defer pty.Close()
+	sshSession, stdin, stdout, stderr := pty.Session, pty.stdin, pty.stdout, pty.stderr
 
-	stdin, err := sshSession.StdinPipe()
-	if err != nil {
-		logger.Err("WebSocket: StdinPipe failed: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to initialize StdinPipe\n"))
-		return
+	// グループに入っていれば入力は他のターミナルにも送られる
+	write := func(p []byte) error {
+		_, err := stdin.Write(p)
+		return err
 	}
-	stdout, err := sshSession.StdoutPipe()
-	if err != nil {
-		logger.Err("WebSocket: StdoutPipe failed: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to initialize StdoutPipe\n"))
-		return
-	}
-	stderr, err := sshSession.StderrPipe()
-	if err != nil {
-		logger.Err("WebSocket: StderrPipe failed: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to initialize StderrPipe\n"))
-		return
-	}
-
-	if err := sshSession.Shell(); err != nil {
-		logger.Err("WebSocket: Failed to start shell: %v", err)
-		conn.WriteMessage(websocket.TextMessage, []byte("Failed to start shell\n"))
-		return
+	if title != "" {
+		t := terminals.Add(sessionID, title, stdin)
+		defer terminals.Remove(t.ID)
+		write = func(p []byte) error { return terminals.Input(t, p) }
 	}
 
 	// SSH stdout を WebSocket に送信
@@ -115,6 +108,10 @@ func terminalWSHandler(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 		}
+		if !logoutOnExit {
+			// コマンドが終了したら WebSocket も閉じる
+			conn.Close()
+		}
 	}()
 
 	// SSH stderr を WebSocket に送信
@@ -149,14 +146,14 @@ func terminalWSHandler(w http.ResponseWriter, r *http.Request) {
 
 		if messageType == websocket.TextMessage {
 			// 通常の入力データとして扱う
-			if _, err := stdin.Write(p); err != nil {
+			if err := write(p); err != nil {
 				logger.Err("WebSocket: Error writing to stdin: %v", err)
 				break
 			}
 
 			// 'exit' コマンドの検出
 			input := string(p)
-			if input == "exit\n" || input == "exit\r\n" {
+			if logoutOnExit && (input == "exit\n" || input == "exit\r\n") {
 				logger.Info("WebSocket: 'exit' command received, ending session")
 				// SSHManager からクライアントを削除
 				sshManager.RemoveClient(sessionID)
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rxxuzi/tune/internal/config"
+	"github.com/rxxuzi/tune/internal/logger"
+	"github.com/rxxuzi/tune/internal/thumb"
+)
+
+// 同時に生成するサムネイルの数 (SSH セッションとメモリの上限)
+var thumbSlots = make(chan struct{}, 4)
+
+func thumbCacheDir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache", "thumbs"), nil
+}
+
+// thumbCachePath returns the cache file for a thumbnail. The key includes
+// the host, path, mtime and size so that changed files get a new entry.
+func thumbCachePath(userHost, abs string, st *remoteStat) (string, error) {
+	dir, err := thumbCacheDir()
+	if err != nil {
+		return "", err
+	}
+	key := hashBytes([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%d", userHost, abs, st.Mtime, st.Size, thumb.Size)))
+	return filepath.Join(dir, key[:2], key+".jpg"), nil
+}
+
+// pruneThumbCache removes thumbnails not used within maxAge, then the least
+// recently used ones until the cache is at most maxSize bytes. The mtime of
+// a cache file is its last use. Zero disables the respective limit.
+func pruneThumbCache(dir string, maxAge time.Duration, maxSize int64, now time.Time) error {
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+			os.Remove(p)
+			return nil
+		}
+		entries = append(entries, entry{p, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if maxSize <= 0 || total <= maxSize {
+		return nil
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return a.used.Compare(b.used) })
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err == nil {
+			total -= e.size
+		}
+	}
+	return nil
+}
+
+// startThumbCachePruning prunes the thumbnail cache now and then every hour
+func startThumbCachePruning() {
+	go func() {
+		for {
+			dir, err := thumbCacheDir()
+			if err == nil {
+				err = pruneThumbCache(dir, conf.Drive.ThumbCacheMaxAge.Std(), conf.Drive.ThumbCacheMaxSize, time.Now())
+			}
+			if err != nil {
+				logger.Warn("Failed to prune thumbnail cache: %v", err)
+			}
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// writeCacheFile writes data to p through a temporary file so that
+// concurrent readers never see a partial thumbnail
+func writeCacheFile(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// driveThumbHandler serves a JPEG thumbnail of an image file, generating
+// and caching it on first request
+func driveThumbHandler(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if file == "" {
+		writeJSONError(w, http.StatusBadRequest, "File not specified")
+		return
+	}
+	if !thumb.Supported(file) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "No thumbnail for this file type")
+		return
+	}
+	auth := authFromContext(r)
+	_, absPath, ok := requestPath(w, r, file)
+	if !ok {
+		return
+	}
+
+	st, err := statRemote(r.Context(), auth.Client, absPath)
+	if err != nil || !strings.HasPrefix(st.Type, "regular") {
+		writeJSONError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if st.Size > conf.Drive.MaxPreviewSize {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "File is too large for a thumbnail")
+		return
+	}
+
+	cachePath, err := thumbCachePath(auth.UserHost(), absPath, st)
+	if err != nil {
+		logger.Err("Failed to resolve thumbnail cache: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Thumbnail cache unavailable")
+		return
+	}
+	modTime := time.Unix(st.Mtime, 0)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", `"`+filepath.Base(cachePath)+`"`)
+
+	if f, err := os.Open(cachePath); err == nil {
+		defer f.Close()
+		// 最後に使った時刻を記録して、よく使うものを削除しないようにする
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+		http.ServeContent(w, r, "", modTime, f)
+		return
+	}
+
+	select {
+	case thumbSlots <- struct{}{}:
+		defer func() { <-thumbSlots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	rc, err := openRemote(auth.Client, absPath, 0, -1)
+	if err != nil {
+		logger.Err("Failed to read %s: %v", absPath, err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+	data, err := thumb.Generate(io.LimitReader(rc, st.Size), thumb.Size)
+	rc.Close()
+	if err != nil {
+		logger.Debug("No thumbnail for %s: %v", absPath, err)
+		status := http.StatusUnsupportedMediaType
+		if errors.Is(err, thumb.ErrTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSONError(w, status, "Failed to create thumbnail")
+		return
+	}
+
+	if err := writeCacheFile(cachePath, data); err != nil {
+		logger.Warn("Failed to cache thumbnail for %s: %v", absPath, err)
+	}
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneThumbCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"aa/old.jpg", 100, 40 * 24 * time.Hour},
+		{"aa/lru.jpg", 100, 5 * time.Hour},
+		{"bb/mid.jpg", 100, 2 * time.Hour},
+		{"bb/new.jpg", 100, time.Minute},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, f.size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(-f.age)
+		os.Chtimes(p, used, used)
+	}
+
+	if err := pruneThumbCache(dir, 30*24*time.Hour, 250, now); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(dir, f.name))
+		kept := err == nil
+		want := f.name == "bb/mid.jpg" || f.name == "bb/new.jpg"
+		if kept != want {
+			t.Errorf("%s kept = %v, want %v", f.name, kept, want)
+		}
+	}
+
+	// キャッシュがまだ無くてもエラーにしない
+	if err := pruneThumbCache(filepath.Join(dir, "missing"), time.Hour, 1, now); err != nil {
+		t.Errorf("missing cache dir: %v", err)
+	}
+}
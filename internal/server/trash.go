@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/command"
+	"github.com/rxxuzi/tune/internal/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// Deleted items are moved to ~/.tune-trash on the remote host. The layout
+// follows the XDG trash specification (files/ and info/<name>.trashinfo)
+// but is kept apart from the desktop trash so that automatic purging
+// never touches items deleted outside tune.
+
+// 削除: 同名の項目があれば name.2, name.3 ... を使う。
+// info ファイルは noclobber で作成し、並行した削除と名前が衝突しないようにする。
+const trashDeleteScript = `set -e
+trash="$HOME/.tune-trash"
+mkdir -p "$trash/files" "$trash/info"
+chmod 700 "$trash"
+base=$(basename -- "$1")
+name=$base
+n=1
+set -C
+until [ ! -e "$trash/files/$name" ] && { printf '[Trash Info]\nPath=%s\nDeletionDate=%s\n' "$2" "$(date +%Y-%m-%dT%H:%M:%S)" > "$trash/info/$name.trashinfo"; } 2>/dev/null; do
+	n=$((n+1))
+	name="$base.$n"
+	if [ "$n" -ge 1000 ]; then echo "too many items named $base in the trash" >&2; exit 1; fi
+done
+set +C
+if ! mv -- "$1" "$trash/files/$name"; then
+	rm -f -- "$trash/info/$name.trashinfo"
+	exit 1
+fi
+printf '%s\n' "$name"`
+
+// 一覧: 名前、info ファイルの内容、種類、サイズを NUL 区切りで出力する
+const trashListScript = `trash="$HOME/.tune-trash"
+cd "$trash/info" 2>/dev/null || exit 0
+for f in *.trashinfo; do
+	[ -f "$f" ] || continue
+	name=${f%.trashinfo}
+	printf '%s\0' "$name"
+	cat -- "$f"
+	printf '\0'
+	stat -c '%F' -- "../files/$name" 2>/dev/null | tr -d '\n'
+	printf '\0'
+	du -sb -- "../files/$name" 2>/dev/null | cut -f1 | tr -d '\n'
+	printf '\0'
+done`
+
+const trashListFields = 4
+
+const trashInfoScript = `cat -- "$HOME/.tune-trash/info/$1.trashinfo"`
+
+const trashRestoreScript = `set -e
+trash="$HOME/.tune-trash"
+if [ ! -e "$trash/files/$1" ] && [ ! -L "$trash/files/$1" ]; then echo "item is no longer in the trash" >&2; exit 1; fi
+if [ -e "$2" ] || [ -L "$2" ]; then echo "$2 already exists" >&2; exit 1; fi
+mkdir -p -- "$(dirname -- "$2")"
+mv -- "$trash/files/$1" "$2"
+rm -f -- "$trash/info/$1.trashinfo"`
+
+const trashPurgeScript = `trash="$HOME/.tune-trash"
+rm -rf -- "$trash/files/$1" && rm -f -- "$trash/info/$1.trashinfo"`
+
+// 削除日時は info ファイルの更新日時と同じなので find -mmin で古いものを探す。
+// 名前には改行も含められるので、パスは行で読まずに -exec で引数として渡す。
+// 削除した名前は NUL 区切りで出力する。
+const trashExpireScript = `trash="$HOME/.tune-trash"
+[ -d "$trash/info" ] || exit 0
+find "$trash/info" -maxdepth 1 -name '*.trashinfo' -mmin +"$1" -exec sh -c '
+trash=$1
+shift
+for f do
+	name=${f##*/}
+	name=${name%.trashinfo}
+	rm -rf -- "$trash/files/$name" && rm -f -- "$f" && printf "%s\0" "$name"
+done' sh "$trash" {} +`
+
+// TrashItem is an item in the trash whose original path is inside the drive root
+type TrashItem struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Deleted string `json:"deleted"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+}
+
+func RegisterTrashHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/trash", requireAuth(trashPageHandler))
+	mux.HandleFunc("/api/drive/delete", requireAuth(driveDeleteHandler))
+	mux.HandleFunc("/api/trash", requireAuth(trashListHandler))
+	mux.HandleFunc("/api/trash/restore", requireAuth(trashRestoreHandler))
+	mux.HandleFunc("/api/trash/purge", requireAuth(trashPurgeHandler))
+}
+
+func trashPageHandler(w http.ResponseWriter, r *http.Request) {
+	logger.Info("/trash accessed")
+	renderTemplate(w, r, "trash", struct {
+		UserHost   string
+		MaxAgeDays int
+	}{
+		UserHost:   authFromContext(r).UserHost(),
+		MaxAgeDays: int(conf.Drive.TrashMaxAge.Std().Hours() / 24),
+	})
+}
+
+// runTrashScript runs one of the trash scripts with args and returns its
+// stdout, turning a non-zero exit into an error with stderr
+func runTrashScript(ctx context.Context, client *ssh.Client, script string, args ...string) (string, error) {
+	argv := append([]string{"sh", "-c", script, "sh"}, args...)
+	res, err := command.Run(ctx, client, argv...)
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		msg := strings.TrimSpace(res.Stderr)
+		if msg == "" {
+			msg = "exit status " + strconv.Itoa(res.ExitCode)
+		}
+		return "", errors.New(msg)
+	}
+	return res.Stdout, nil
+}
+
+// encodeTrashPath escapes a path for the Path key of a .trashinfo file
+func encodeTrashPath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// parseTrashInfo returns the original path and deletion date of a .trashinfo file
+func parseTrashInfo(info string) (orig, deleted string, ok bool) {
+	for _, line := range strings.Split(info, "\n") {
+		if v, found := strings.CutPrefix(line, "Path="); found {
+			p, err := url.PathUnescape(v)
+			if err != nil {
+				return "", "", false
+			}
+			orig = p
+		} else if v, found := strings.CutPrefix(line, "DeletionDate="); found {
+			deleted = v
+		}
+	}
+	return orig, deleted, orig != ""
+}
+
+// validTrashName rejects names that would leave the trash directory
+func validTrashName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// purgeExpiredTrash removes items older than the configured age
+func purgeExpiredTrash(ctx context.Context, auth *AuthContext) {
+	age := conf.Drive.TrashMaxAge.Std()
+	if age <= 0 {
+		return
+	}
+	minutes := strconv.Itoa(int(age.Minutes()))
+	out, err := runTrashScript(ctx, auth.Client, trashExpireScript, minutes)
+	if err != nil {
+		logger.Warn("Failed to purge expired trash of %s: %v", auth.UserHost(), err)
+		return
+	}
+	if n := strings.Count(out, "\x00"); n > 0 {
+		logger.Info("Purged %d expired trash items of %s", n, auth.UserHost())
+	}
+}
+
+// driveDeleteHandler moves the selected paths to the trash
+func driveDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Paths []string `json:"paths"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if len(req.Paths) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No files selected")
+		return
+	}
+	auth := authFromContext(r)
+	root, err := driveRoot(r.Context(), auth)
+	if err != nil {
+		logger.Err("Failed to resolve drive root: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to resolve drive root")
+		return
+	}
+
+	results := make([]PathResult, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		res := PathResult{Path: p}
+		abs, err := resolvePath(r.Context(), auth.Client, root, p)
+		switch {
+		case err != nil:
+			res.Error = err.Error()
+		case abs == root:
+			res.Error = "refusing to delete the drive root"
+		default:
+			if _, err := runTrashScript(r.Context(), auth.Client, trashDeleteScript, abs, encodeTrashPath(abs)); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.OK = true
+			}
+		}
+		if res.OK {
+			logger.Info("Moved to trash by %s: %s", auth.UserHost(), abs)
+		} else {
+			logger.Warn("Failed to move %q to trash (%s): %s", p, auth.UserHost(), res.Error)
+		}
+		results = append(results, res)
+	}
+
+	purgeExpiredTrash(r.Context(), auth)
+	writeJSON(w, results)
+}
+
+func trashListHandler(w http.ResponseWriter, r *http.Request) {
+	auth := authFromContext(r)
+	root, err := driveRoot(r.Context(), auth)
+	if err != nil {
+		logger.Err("Failed to resolve drive root: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to resolve drive root")
+		return
+	}
+	purgeExpiredTrash(r.Context(), auth)
+
+	out, err := runTrashScript(r.Context(), auth.Client, trashListScript)
+	if err != nil {
+		logger.Err("Failed to list trash of %s: %v", auth.UserHost(), err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to list trash")
+		return
+	}
+
+	items := []TrashItem{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+trashListFields <= len(fields); i += trashListFields {
+		f := fields[i : i+trashListFields]
+		orig, deleted, ok := parseTrashInfo(f[1])
+		// ドライブのルート外から削除されたものは表示しない
+		if !ok || !isWithin(root, orig) {
+			continue
+		}
+		size, _ := strconv.ParseInt(f[3], 10, 64)
+		items = append(items, TrashItem{
+			Name:    f[0],
+			Path:    relativePath(root, orig),
+			Deleted: deleted,
+			Type:    f[2],
+			Size:    size,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Deleted > items[j].Deleted
+	})
+	writeJSON(w, items)
+}
+
+// trashItemPath reads the original path of a trash item and checks that
+// it can be restored inside the drive root
+func trashItemPath(ctx context.Context, auth *AuthContext, root, name string) (string, error) {
+	info, err := runTrashScript(ctx, auth.Client, trashInfoScript, name)
+	if err != nil {
+		return "", err
+	}
+	orig, _, ok := parseTrashInfo(info)
+	if !ok {
+		return "", errors.New("invalid trash info")
+	}
+	return resolvePath(ctx, auth.Client, root, orig)
+}
+
+// trashAction applies fn to each named trash item, checking that the item
+// belongs to the drive root first
+func trashAction(w http.ResponseWriter, r *http.Request, verb string, fn func(ctx context.Context, auth *AuthContext, name, orig string) error) {
+	var req struct {
+		Names []string `json:"names"`
+	}
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if len(req.Names) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No items selected")
+		return
+	}
+	auth := authFromContext(r)
+	root, err := driveRoot(r.Context(), auth)
+	if err != nil {
+		logger.Err("Failed to resolve drive root: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to resolve drive root")
+		return
+	}
+
+	results := make([]PathResult, 0, len(req.Names))
+	for _, name := range req.Names {
+		res := PathResult{Path: name}
+		if !validTrashName(name) {
+			res.Error = "invalid name"
+		} else if orig, err := trashItemPath(r.Context(), auth, root, name); err != nil {
+			res.Error = err.Error()
+		} else if err := fn(r.Context(), auth, name, orig); err != nil {
+			res.Error = err.Error()
+		} else {
+			res.OK = true
+			logger.Info("Trash %s by %s: %s", verb, auth.UserHost(), orig)
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, results)
+}
+
+func trashRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	trashAction(w, r, "restore", func(ctx context.Context, auth *AuthContext, name, orig string) error {
+		_, err := runTrashScript(ctx, auth.Client, trashRestoreScript, name, orig)
+		return err
+	})
+}
+
+func trashPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	trashAction(w, r, "purge", func(ctx context.Context, auth *AuthContext, name, orig string) error {
+		_, err := runTrashScript(ctx, auth.Client, trashPurgeScript, name)
+		return err
+	})
+}
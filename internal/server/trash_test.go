@@ -0,0 +1,131 @@
+package server
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrashInfoRoundTrip(t *testing.T) {
+	for _, p := range []string{
+		"/home/u/report.txt",
+		"/home/u/with space/a b.txt",
+		"/home/u/100%/x+y.txt",
+		"/home/u/日本語/ファイル",
+		"/home/u/line\nbreak",
+		"/home/u/Path=trick",
+	} {
+		info := "[Trash Info]\nPath=" + encodeTrashPath(p) + "\nDeletionDate=2024-05-01T10:20:30\n"
+		orig, deleted, ok := parseTrashInfo(info)
+		if !ok || orig != p || deleted != "2024-05-01T10:20:30" {
+			t.Errorf("round trip of %q = %q, %q, %v", p, orig, deleted, ok)
+		}
+	}
+}
+
+func TestEncodeTrashPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/home/u/a.txt", "/home/u/a.txt"},
+		{"/home/u/a b", "/home/u/a%20b"},
+		{"/home/u/100%", "/home/u/100%25"},
+		{"/home/u/a\nb", "/home/u/a%0Ab"},
+	}
+	for _, tt := range tests {
+		if got := encodeTrashPath(tt.in); got != tt.want {
+			t.Errorf("encodeTrashPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrashInfoInvalid(t *testing.T) {
+	for _, info := range []string{
+		"",
+		"[Trash Info]\nDeletionDate=2024-05-01T10:20:30\n",
+		"[Trash Info]\nPath=/home/u/%zz\n",
+	} {
+		if _, _, ok := parseTrashInfo(info); ok {
+			t.Errorf("parseTrashInfo(%q) succeeded, want failure", info)
+		}
+	}
+}
+
+func TestValidTrashName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"report.txt":   true,
+		"report.txt.2": true,
+		"..hidden":     true,
+		"":             false,
+		".":            false,
+		"..":           false,
+		"../x":         false,
+		"a/b":          false,
+	} {
+		if got := validTrashName(name); got != want {
+			t.Errorf("validTrashName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// trashExpireScript をローカルの sh で実行して、改行を含む名前で
+// 期限切れでない別の項目が消えないことを確かめる
+func TestTrashExpireScript(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	home := t.TempDir()
+	trash := filepath.Join(home, ".tune-trash")
+	old := time.Now().Add(-2 * time.Hour)
+	items := []struct {
+		name    string
+		expired bool
+	}{
+		{"a\nb", true},
+		{"a", false},
+		{"b", false},
+		{"old report.txt", true},
+		{"new\n", false},
+	}
+	for _, it := range items {
+		for _, dir := range []string{"files", "info"} {
+			if err := os.MkdirAll(filepath.Join(trash, dir), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(trash, "files", it.name), []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		info := filepath.Join(trash, "info", it.name+".trashinfo")
+		if err := os.WriteFile(info, []byte("[Trash Info]\nPath=/x\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if it.expired {
+			os.Chtimes(info, old, old)
+		}
+	}
+
+	cmd := exec.Command(sh, "-c", trashExpireScript, "sh", "60")
+	cmd.Env = append(os.Environ(), "HOME="+home)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("script failed: %v", err)
+	}
+	purged := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	sort.Strings(purged)
+	if want := []string{"a\nb", "old report.txt"}; strings.Join(purged, "|") != strings.Join(want, "|") {
+		t.Errorf("purged %q, want %q", purged, want)
+	}
+	for _, it := range items {
+		_, errFile := os.Lstat(filepath.Join(trash, "files", it.name))
+		_, errInfo := os.Lstat(filepath.Join(trash, "info", it.name+".trashinfo"))
+		if kept := errFile == nil && errInfo == nil; kept == it.expired {
+			t.Errorf("%q: kept = %v, expired = %v", it.name, kept, it.expired)
+		}
+	}
+}
@@ -2,7 +2,7 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/rxxuzi/tune/internal/command"
 	"io"
@@ -24,128 +24,81 @@ type FolderItem struct {
 }
 
 func RegisterUploaderHandlers(mux *http.ServeMux) {
-	mux.HandleFunc("/uploader", uploaderPageHandler)
-	mux.HandleFunc("/api/folder-tree", folderTreeHandler)
-	mux.HandleFunc("/api/upload", uploadHandler)
+	mux.HandleFunc("/uploader", requireAuth(uploaderPageHandler))
+	mux.HandleFunc("/api/folder-tree", requireAuth(folderTreeHandler))
+	mux.HandleFunc("/api/upload", requireAuth(uploadHandler))
 }
 
 func uploaderPageHandler(w http.ResponseWriter, r *http.Request) {
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
-	_, exists := sshManager.GetClient(sessionID)
-	if !exists {
-		logger.Warn("SSH connection does not exist for session")
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	// upload.html を描画
-	renderTemplate(w, "upload", nil)
+	renderTemplate(w, r, "upload", nil)
 }
 
 func folderTreeHandler(w http.ResponseWriter, r *http.Request) {
-	sess, err := getSession(r)
+	auth := authFromContext(r)
+	root, err := driveRoot(r.Context(), auth)
 	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+		logger.Err("Failed to resolve drive root: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to resolve drive root")
 		return
 	}
 
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Error(w, "Invalid session", http.StatusBadRequest)
-		return
-	}
-
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
-		return
-	}
-
-	tree, err := getRemoteFolderTree(client)
+	tree, err := getRemoteFolderTree(r.Context(), auth.Client, root)
 	if err != nil {
 		logger.Err("Failed to get remote folder tree: %v", err)
-		http.Error(w, "Failed to get folder tree", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to get folder tree")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tree)
+	writeJSON(w, tree)
 }
 
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	sess, err := getSession(r)
-	if err != nil {
-		logger.Err("Failed to retrieve session: %v", err)
-		http.Error(w, "Session error", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	sessionID, ok := sess.Values["session_id"].(string)
-	if !ok || sessionID == "" {
-		logger.Warn("Session does not contain session_id")
-		http.Error(w, "Invalid session", http.StatusBadRequest)
-		return
-	}
+	client := authFromContext(r).Client
 
-	client, exists := sshManager.GetClient(sessionID)
-	if !exists || client == nil {
-		logger.Warn("SSH connection does not exist for session")
-		http.Error(w, "SSH not connected", http.StatusForbidden)
+	err := r.ParseMultipartForm(32 << 20) // 32MB
+	if err != nil {
+		logger.Err("Failed to parse multipart form: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "Invalid form data")
 		return
 	}
 
-	err = r.ParseMultipartForm(32 << 20) // 32MB
-	if err != nil {
-		logger.Err("Failed to parse multipart form: %v", err)
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	if !checkCSRF(w, r) {
 		return
 	}
 
 	destination := r.FormValue("destination")
 	if destination == "" {
 		logger.Err("Destination path is missing")
-		http.Error(w, "Destination path is required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Destination path is required")
 		return
 	}
 
 	files := r.MultipartForm.File["files"]
 	if len(files) == 0 {
 		logger.Err("No files uploaded")
-		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "No files uploaded")
 		return
 	}
 
-	// ホームディレクトリを取得
-	homeDir, err := command.ExecuteCommand(client, "echo $HOME")
-	if err != nil {
-		logger.Err("Failed to get home directory: %v", err)
-		http.Error(w, "Failed to get home directory", http.StatusInternalServerError)
+	// アップロード先をドライブのルート内に解決
+	root, destPath, ok := requestPath(w, r, destination)
+	if !ok {
 		return
 	}
-	homeDir = strings.TrimSpace(homeDir) // 改行を削除
 
 	for _, fileHeader := range files {
+		name := path.Base(strings.ReplaceAll(fileHeader.Filename, "\\", "/"))
+		if name == "." || name == ".." || name == "/" {
+			logger.Warn("Rejected invalid upload file name: %q", fileHeader.Filename)
+			continue
+		}
+
 		file, err := fileHeader.Open()
 		if err != nil {
 			logger.Err("Failed to open uploaded file: %v", err)
@@ -154,8 +107,13 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 
 		// ファイルをアップロード後にクローズ
 		// defer file.Close() はループ内で使用すると全てのファイルが最後に閉じられるため避ける
-		remotePath := path.Join(destination, fileHeader.Filename)
-		fullRemotePath := path.Join(homeDir, remotePath)
+		// 既存のシンボリックリンクを上書きしてルートの外へ書き込まないよう再検査する
+		fullRemotePath, err := resolvePath(r.Context(), client, root, path.Join(destPath, name))
+		if err != nil {
+			logger.Warn("Rejected upload target %s/%s: %v", destPath, name, err)
+			file.Close()
+			continue
+		}
 
 		// ログにリモートパスを表示
 		logger.Debug("Uploading file to remote path: %s", fullRemotePath)
@@ -184,7 +142,7 @@ func uploadFile(client *ssh.Client, file io.Reader, remotePath string) error {
 
 	// scp コマンドを使用してファイルをアップロード
 	// 'C0644 filesize filename' を送信し、続けてファイルデータを送信する
-	cmd := fmt.Sprintf("scp -t %s", remotePath)
+	cmd := command.Join("scp", "-t", "--", remotePath)
 	stdin, err := session.StdinPipe()
 	if err != nil {
 		return err
@@ -213,34 +171,24 @@ func uploadFile(client *ssh.Client, file io.Reader, remotePath string) error {
 	return session.Wait()
 }
 
-// getRemoteFolderTree はリモートサーバーのフォルダツリーを取得します
-func getRemoteFolderTree(client *ssh.Client) ([]FolderItem, error) {
-	// ユーザーのホームディレクトリを取得
-	homeDir, err := command.ExecuteCommand(client, "echo $HOME")
-	if err != nil {
-		return nil, err
-	}
-	homeDir = strings.TrimSpace(homeDir) // 改行を削除
-	logger.Debug("Home -> %s", homeDir)
-
-	// フォルダツリーを取得
-	cmdFind := fmt.Sprintf("find %s -type d -print 2>/dev/null", homeDir)
+// getRemoteFolderTree はドライブのルート以下のフォルダツリーを取得します
+func getRemoteFolderTree(ctx context.Context, client *ssh.Client, root string) ([]FolderItem, error) {
+	logger.Debug("Root -> %s", root)
 
-	output, err := command.ExecuteCommand(client, cmdFind)
+	// フォルダツリーを取得 (権限のないフォルダのエラーは無視する)
+	result, err := command.Run(ctx, client, "find", root, "-type", "d", "-print")
 	if err != nil {
 		logger.Err("Failed to get remote folder tree: %v", err)
 		return nil, err
 	}
 
-	dirs := strings.Split(output, "\n")
+	dirs := strings.Split(strings.TrimSpace(result.Stdout), "\n")
 
-	// ホームディレクトリ基点の相対パスに変換
+	// ルート基点の相対パスに変換
 	var relativeDirs []string
 	for _, dir := range dirs {
-		if strings.HasPrefix(dir, homeDir) {
-			trimmedDir := strings.TrimPrefix(dir, homeDir)
-			trimmedDir = strings.TrimPrefix(trimmedDir, "/") // 最初のスラッシュを削除
-			relativeDirs = append(relativeDirs, trimmedDir)
+		if isWithin(root, dir) {
+			relativeDirs = append(relativeDirs, relativePath(root, dir))
 		}
 	}
 
@@ -2,6 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rxxuzi/tune/internal/logger"
 )
 
 func parseJSONToSSHInfo(data []byte) (SSHInfo, error) {
@@ -9,3 +13,54 @@ func parseJSONToSSHInfo(data []byte) (SSHInfo, error) {
 	err := json.Unmarshal(data, &info)
 	return info, err
 }
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Err("Failed to encode JSON response: %v", err)
+	}
+}
+
+// writeJSONError writes {"error": message} with the given status code
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// decodeJSONPost checks the method and CSRF token and decodes the JSON body into v.
+// It writes a JSON error and returns false if any of them fails.
+func decodeJSONPost(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return false
+	}
+	if !checkCSRF(w, r) {
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request")
+		return false
+	}
+	return true
+}
+
+// parseTags splits a comma separated tag list
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// privileged prefixes argv with "sudo -n" when the profile of host enables sudo
+func privileged(host string, argv ...string) []string {
+	if !conf.Profile(host).Sudo {
+		return argv
+	}
+	return append([]string{"sudo", "-n", "--"}, argv...)
+}
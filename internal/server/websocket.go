@@ -0,0 +1,27 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn serializes writes to a WebSocket connection shared by several goroutines
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+// WriteJSON writes v as a JSON text message
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// WriteMessage writes a single message
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
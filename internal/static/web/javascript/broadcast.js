@@ -0,0 +1,105 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const hostList = document.getElementById('hostList');
+    const terminalTable = document.getElementById('terminalTable');
+    const status = document.getElementById('status');
+
+    // グループ ID ごとに色を割り当てて見分けやすくする
+    const groupColors = ['#ff6b9d', '#64d2ff', '#ffd60a', '#30d158', '#bf5af2', '#ff9f0a'];
+    const groupIndex = new Map();
+
+    fetch('/api/multi/hosts')
+        .then(response => response.json())
+        .then(hosts => {
+            hosts.forEach(h => {
+                const a = document.createElement('a');
+                a.className = 'btn secondary';
+                a.href = `/terminal?host=${encodeURIComponent(h.host)}`;
+                a.target = '_blank';
+                a.innerHTML = '<span class="material-icons">terminal</span>';
+                a.appendChild(document.createTextNode(`${h.user}@${h.host}`));
+                hostList.appendChild(a);
+            });
+        })
+        .catch(err => console.error('Failed to load saved hosts:', err));
+
+    function loadTerminals() {
+        fetch('/api/terminals')
+            .then(response => response.json())
+            .then(renderTerminals)
+            .catch(err => {
+                status.textContent = `Failed to load terminals: ${err.message}`;
+            });
+    }
+
+    function renderTerminals(list) {
+        const checked = new Set(selected());
+        terminalTable.innerHTML = '';
+        if (list.length === 0) {
+            terminalTable.innerHTML = '<tr><td colspan="4" class="muted">No open terminals</td></tr>';
+        }
+        list.forEach((t, i) => {
+            if (t.group && !groupIndex.has(t.group)) {
+                groupIndex.set(t.group, groupIndex.size);
+            }
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td><input type="checkbox" value="${t.id}" ${checked.has(t.id) ? 'checked' : ''}></td>
+                <td>#${i + 1} ${escapeHtml(t.title)}</td>
+                <td class="muted">${new Date(t.opened).toLocaleTimeString()}</td>
+                <td></td>
+            `;
+            if (t.group) {
+                const n = groupIndex.get(t.group);
+                const badge = document.createElement('span');
+                badge.className = 'group-badge';
+                badge.style.borderColor = groupColors[n % groupColors.length];
+                badge.textContent = `Group ${n + 1}`;
+                tr.lastElementChild.appendChild(badge);
+            } else {
+                tr.lastElementChild.innerHTML = '<span class="muted">-</span>';
+            }
+            terminalTable.appendChild(tr);
+        });
+        const groups = new Set(list.filter(t => t.group).map(t => t.group));
+        status.textContent = `${list.length} terminal(s), ${groups.size} group(s)`;
+    }
+
+    function selected() {
+        return [...terminalTable.querySelectorAll('input:checked')].map(cb => cb.value);
+    }
+
+    document.getElementById('groupBtn').addEventListener('click', () => {
+        const ids = selected();
+        if (ids.length < 2) {
+            status.textContent = 'Select at least two terminals.';
+            return;
+        }
+        postJSON('/api/terminals/group', {ids: ids})
+            .then(loadTerminals)
+            .catch(err => {
+                status.textContent = `Failed to group: ${err.message}`;
+            });
+    });
+
+    document.getElementById('ungroupBtn').addEventListener('click', () => {
+        postJSON('/api/terminals/ungroup', {ids: selected()})
+            .then(loadTerminals)
+            .catch(err => {
+                status.textContent = `Failed to ungroup: ${err.message}`;
+            });
+    });
+
+    document.getElementById('refreshBtn').addEventListener('click', loadTerminals);
+
+    // 別タブで開いたターミナルを反映する
+    window.addEventListener('focus', loadTerminals);
+    loadTerminals();
+
+    function escapeHtml(str) {
+        if (!str) return '';
+        return str.replace(/&/g, '&amp;')
+            .replace(/</g, '&lt;')
+            .replace(/>/g, '&gt;')
+            .replace(/"/g, '&quot;');
+    }
+});
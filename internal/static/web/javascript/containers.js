@@ -0,0 +1,123 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const containerTable = document.getElementById('containerTable');
+    const imageTable = document.getElementById('imageTable');
+    const filterInput = document.getElementById('filterInput');
+    const runningOnly = document.getElementById('runningOnly');
+    const runtime = document.getElementById('runtime');
+    const status = document.getElementById('status');
+
+    let containers = [];
+
+    loadContainers();
+    document.getElementById('refreshBtn').addEventListener('click', loadContainers);
+    filterInput.addEventListener('input', renderContainers);
+    runningOnly.addEventListener('change', renderContainers);
+
+    function loadContainers() {
+        status.textContent = 'Loading...';
+        fetch('/api/containers')
+            .then(async response => {
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || response.statusText);
+                return data;
+            })
+            .then(data => {
+                status.textContent = '';
+                runtime.textContent = `(${data.runtime})`;
+                containers = data.containers;
+                renderContainers();
+                renderImages(data.images);
+            })
+            .catch(err => status.textContent = err.message);
+    }
+
+    function iconLink(icon, title, href) {
+        const a = document.createElement('a');
+        a.className = 'icon-btn';
+        a.title = title;
+        a.target = '_blank';
+        a.href = href;
+        a.innerHTML = `<span class="material-icons">${icon}</span>`;
+        return a;
+    }
+
+    function iconButton(icon, title, onClick) {
+        const btn = document.createElement('button');
+        btn.className = 'icon-btn';
+        btn.title = title;
+        btn.innerHTML = `<span class="material-icons">${icon}</span>`;
+        btn.addEventListener('click', onClick);
+        return btn;
+    }
+
+    function renderContainers() {
+        const filter = filterInput.value.trim().toLowerCase();
+        const shown = containers.filter(c =>
+            (!filter || c.name.toLowerCase().includes(filter) || c.image.toLowerCase().includes(filter)) &&
+            (!runningOnly.checked || c.state === 'running'));
+
+        containerTable.innerHTML = '';
+        if (shown.length === 0) {
+            containerTable.innerHTML = '<tr><td colspan="6" class="muted">No containers</td></tr>';
+            return;
+        }
+        shown.forEach(c => {
+            const running = c.state === 'running';
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td></td>
+                <td class="mono"></td>
+                <td></td>
+                <td class="mono muted"></td>
+                <td class="mono muted"></td>
+                <td></td>
+            `;
+            tr.children[0].textContent = c.name;
+            tr.children[1].textContent = c.image;
+            tr.children[2].textContent = c.status;
+            tr.children[2].className = running ? 'status-ok' : 'muted';
+            tr.children[3].textContent = c.ports;
+            tr.children[4].textContent = c.id;
+
+            const cell = tr.children[5];
+            if (running) {
+                cell.appendChild(iconButton('stop', 'Stop', () => runAction(c, 'stop')));
+                cell.appendChild(iconButton('restart_alt', 'Restart', () => runAction(c, 'restart')));
+                cell.appendChild(iconLink('terminal', 'Shell', `/containers/exec?id=${encodeURIComponent(c.id)}`));
+            } else {
+                cell.appendChild(iconButton('play_arrow', 'Start', () => runAction(c, 'start')));
+            }
+            cell.appendChild(iconLink('receipt_long', 'Logs', `/containers/logs?id=${encodeURIComponent(c.id)}`));
+            containerTable.appendChild(tr);
+        });
+    }
+
+    function renderImages(images) {
+        imageTable.innerHTML = '';
+        if (images.length === 0) {
+            imageTable.innerHTML = '<tr><td colspan="5" class="muted">No images</td></tr>';
+            return;
+        }
+        images.forEach(img => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = '<td class="mono"></td><td class="mono"></td><td class="mono muted"></td><td></td><td class="muted"></td>';
+            tr.children[0].textContent = img.repository;
+            tr.children[1].textContent = img.tag;
+            tr.children[2].textContent = img.id.substring(0, 12);
+            tr.children[3].textContent = img.size;
+            tr.children[4].textContent = img.created;
+            imageTable.appendChild(tr);
+        });
+    }
+
+    function runAction(c, action) {
+        if (action !== 'start' && !confirm(`${action} ${c.name}?`)) return;
+        status.textContent = `${action} ${c.name}...`;
+        postJSON('/api/containers/action', {id: c.id, action})
+            .then(() => {
+                status.textContent = `${action} ${c.name}: done`;
+                loadContainers();
+            })
+            .catch(err => status.textContent = `${action} ${c.name}: ${err.message}`);
+    }
+});
@@ -0,0 +1,25 @@
+// CSRFトークンを全てのリクエストに付与する
+const csrfToken = document.querySelector('meta[name="csrf-token"]')?.getAttribute('content') || '';
+
+if (window.jQuery) {
+    $.ajaxSetup({
+        headers: {'X-CSRF-Token': csrfToken}
+    });
+}
+
+// postJSON は CSRF トークン付きで JSON を送信する
+function postJSON(url, body) {
+    return fetch(url, {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken},
+        body: JSON.stringify(body)
+    }).then(async (response) => {
+        const data = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            const err = new Error(data.error || response.statusText);
+            err.status = response.status;
+            throw err;
+        }
+        return data;
+    });
+}
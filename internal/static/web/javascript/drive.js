@@ -13,6 +13,8 @@ $(document).ready(function() {
     let currentRelPath = initialPath;
     let currentFiles = [];
     let currentFileIndex = -1;
+    // アーカイブでダウンロードするパス
+    const selected = new Set();
 
     const loadingMessage = $('<div id="loadingMessage">Now Loading...</div>');
     $('.drive-container').append(loadingMessage);
@@ -66,6 +68,8 @@ $(document).ready(function() {
 
         currentFiles = files;
         currentFileIndex = -1;
+        selected.clear();
+        updateSelection();
 
         if (p !== '') {
             const parentPath = p.split('/').slice(0, -1).join('/');
@@ -100,6 +104,7 @@ $(document).ready(function() {
                 history.pushState(null, '', '/drive/' + item.path);
                 loadDirectory(item.path);
             });
+            addSelectBox(div, item.path);
             folderGrid.append(div);
         });
 
@@ -114,16 +119,267 @@ $(document).ready(function() {
                     </div>
                 </div>
             `);
+            if (hasThumbnail(item.name)) {
+                // サムネイルが取得できなければアイコンのまま
+                const img = $('<img class="thumb" loading="lazy" alt="">');
+                img.on('load', function() {
+                    div.find('.material-icons').replaceWith(img);
+                });
+                img.attr('src', '/api/drive/thumb?file=' + encodeURIComponent(item.path));
+            }
             div.click(function(){
                 currentFileIndex = index;
                 previewFile(item);
             });
+            addSelectBox(div, item.path);
             fileGrid.append(div);
         });
 
         updateBreadcrumb(p);
     }
 
+    function addSelectBox(div, itemPath) {
+        const box = $('<input type="checkbox" class="select-item" title="Select">');
+        box.click(function(e) {
+            e.stopPropagation();
+            if (this.checked) {
+                selected.add(itemPath);
+            } else {
+                selected.delete(itemPath);
+            }
+            div.toggleClass('selected', this.checked);
+            updateSelection();
+        });
+        div.append(box);
+    }
+
+    function updateSelection() {
+        $('#selectionCount').text(selected.size ? `${selected.size} selected` : 'No selection');
+        $('#downloadSelection').prop('disabled', selected.size === 0);
+        $('#editPermissions').prop('disabled', selected.size === 0);
+        $('#deleteSelection').prop('disabled', selected.size === 0);
+    }
+
+    // フォーム送信でダウンロードさせ、アーカイブをブラウザ側で保持しない
+    function downloadArchive(paths) {
+        const form = $('<form method="POST" action="/api/drive/archive" style="display:none"></form>');
+        paths.forEach(p => form.append($('<input type="hidden" name="path">').val(p)));
+        form.append($('<input type="hidden" name="format">').val($('#archiveFormat').val()));
+        form.append($('<input type="hidden" name="exclude">').val($('#archiveExclude').val()));
+        form.append($('<input type="hidden" name="csrf_token">').val(csrfToken));
+        $('body').append(form);
+        form.submit();
+        form.remove();
+    }
+
+    $('#downloadSelection').click(function() {
+        if (selected.size) downloadArchive(Array.from(selected));
+    });
+
+    $('#downloadFolder').click(function() {
+        downloadArchive([currentRelPath]);
+    });
+
+    // 削除はゴミ箱への移動で、/trash から元に戻せる
+    $('#deleteSelection').click(function() {
+        const paths = Array.from(selected);
+        if (!paths.length || !confirm(`Move ${paths.length} item(s) to the trash?`)) return;
+        postJSON('/api/drive/delete', {paths: paths}).then(function(results) {
+            const failed = results.filter(r => !r.ok);
+            if (failed.length) {
+                alert(failed.map(r => `${r.path}: ${r.error}`).join('\n'));
+            }
+            loadDirectory(currentRelPath);
+        }).catch(function(err) {
+            alert('Delete failed: ' + err.message);
+        });
+    });
+
+    // パーミッションと所有者の編集。最初に選択したファイルの値を初期値にする
+    const permModal = $('#permModal');
+    const permBits = permModal.find('input[data-bit]');
+
+    function modeFromBits() {
+        let mode = 0;
+        permBits.each(function() {
+            if (this.checked) mode |= parseInt($(this).data('bit'), 10);
+        });
+        return mode;
+    }
+
+    function setBits(mode) {
+        permBits.each(function() {
+            this.checked = (mode & parseInt($(this).data('bit'), 10)) !== 0;
+        });
+        $('#permSymbolic').text(symbolicMode(mode));
+    }
+
+    function symbolicMode(mode) {
+        const chars = ['r', 'w', 'x'];
+        let s = '';
+        for (let i = 8; i >= 0; i--) {
+            s += (mode & (1 << i)) ? chars[(8 - i) % 3] : '-';
+        }
+        const special = [[2048, 2, 's'], [1024, 5, 's'], [512, 8, 't']];
+        special.forEach(([bit, pos, ch]) => {
+            if (mode & bit) {
+                s = s.substring(0, pos) + (s[pos] === 'x' ? ch : ch.toUpperCase()) + s.substring(pos + 1);
+            }
+        });
+        return s;
+    }
+
+    permBits.on('change', function() {
+        const mode = modeFromBits();
+        $('#permMode').val(mode.toString(8).padStart(4, '0'));
+        $('#permSymbolic').text(symbolicMode(mode));
+    });
+
+    $('#permMode').on('input', function() {
+        const v = $(this).val();
+        if (/^[0-7]{3,4}$/.test(v)) setBits(parseInt(v, 8));
+    });
+
+    $('#editPermissions').click(function() {
+        const paths = Array.from(selected);
+        if (!paths.length) return;
+        $('#permTitle').text(paths.length === 1 ? getFileName(paths[0]) : `${paths.length} items`);
+        $('#permResults').empty();
+        $('#permRecursive').prop('checked', false);
+        $.getJSON('/api/drive/stat', {file: paths[0]}).done(function(attrs) {
+            $('#permMode').val(attrs.mode);
+            setBits(parseInt(attrs.mode, 8));
+            $('#permOwner').val(attrs.owner);
+            $('#permGroup').val(attrs.group);
+        }).fail(function() {
+            $('#permResults').html('<li class="error">Failed to read current permissions.</li>');
+        });
+        permModal.addClass('active');
+    });
+
+    function showPermResults(results) {
+        const list = $('#permResults').empty();
+        const failed = results.filter(r => !r.ok);
+        if (!failed.length) {
+            list.append(`<li class="ok">Updated ${results.length} item${results.length === 1 ? '' : 's'}.</li>`);
+        }
+        failed.forEach(r => {
+            list.append(`<li class="error">${escapeHtml(r.path)}: ${escapeHtml(r.error)}</li>`);
+        });
+    }
+
+    function applyPermissions(url, body) {
+        body.paths = Array.from(selected);
+        body.recursive = $('#permRecursive').prop('checked');
+        postJSON(url, body).then(showPermResults).catch(function(err) {
+            $('#permResults').html(`<li class="error">${escapeHtml(err.message)}</li>`);
+        });
+    }
+
+    $('#applyMode').click(function() {
+        applyPermissions('/api/drive/chmod', {mode: $('#permMode').val()});
+    });
+
+    $('#applyOwner').click(function() {
+        applyPermissions('/api/drive/chown', {owner: $('#permOwner').val(), group: $('#permGroup').val()});
+    });
+
+    permModal.find('.perm-close').click(function() {
+        permModal.removeClass('active');
+    });
+
+    permModal.click(function(e) {
+        if ($(e.target).is(permModal)) permModal.removeClass('active');
+    });
+
+    // 検索結果は NDJSON で少しずつ届くので、届いた分から表示する
+    let searchController = null;
+
+    $('#searchForm').on('submit', function(e) {
+        e.preventDefault();
+        if (searchController) searchController.abort();
+        const params = new URLSearchParams(new FormData(this));
+        params.set('path', currentRelPath);
+        for (const [k, v] of Array.from(params.entries())) {
+            if (v === '' && k !== 'path') params.delete(k);
+        }
+        runSearch(params);
+    });
+
+    $('#searchStop').click(function() {
+        if (searchController) searchController.abort();
+    });
+
+    async function runSearch(params) {
+        const controller = new AbortController();
+        searchController = controller;
+        const results = $('#searchResults').empty();
+        const status = $('#searchStatus').text('Searching...');
+        $('#searchStop').prop('disabled', false);
+        let count = 0;
+
+        try {
+            const response = await fetch('/api/drive/search?' + params.toString(), {signal: controller.signal});
+            if (!response.ok) {
+                const data = await response.json().catch(() => ({}));
+                throw new Error(data.error || response.statusText);
+            }
+            const reader = response.body.getReader();
+            const decoder = new TextDecoder();
+            let buf = '';
+            for (;;) {
+                const {value, done} = await reader.read();
+                if (done) break;
+                buf += decoder.decode(value, {stream: true});
+                let nl;
+                while ((nl = buf.indexOf('\n')) >= 0) {
+                    const line = buf.slice(0, nl);
+                    buf = buf.slice(nl + 1);
+                    if (!line) continue;
+                    const msg = JSON.parse(line);
+                    if (msg.done) {
+                        let text = `${msg.count} result${msg.count === 1 ? '' : 's'}`;
+                        if (msg.truncated) text += ' (limit reached, refine the search)';
+                        if (msg.error) text += ` - ${msg.error}`;
+                        status.text(text);
+                    } else {
+                        count++;
+                        results.append(searchResultItem(msg));
+                        status.text(`Searching... ${count} found`);
+                    }
+                }
+            }
+        } catch (err) {
+            if (err.name === 'AbortError') {
+                status.text(`Stopped after ${count} result${count === 1 ? '' : 's'}`);
+            } else {
+                status.text('Search failed: ' + err.message);
+            }
+        } finally {
+            if (searchController === controller) {
+                searchController = null;
+                $('#searchStop').prop('disabled', true);
+            }
+        }
+    }
+
+    function searchResultItem(res) {
+        // フォルダはその中へ、ファイルは親フォルダへ移動する
+        const target = res.type === 'folder' ? res.path : res.path.split('/').slice(0, -1).join('/');
+        const icon = res.type === 'folder' ? 'folder' : getFileIcon(res.name);
+        const date = new Date(res.mtime * 1000).toLocaleString();
+        const size = res.type === 'folder' ? '' : formatBytes(res.size);
+        return $(`
+            <li>
+                <a href="/drive/${encodeURI(target)}">
+                    <span class="material-icons">${icon}</span>
+                    <span class="result-path">${escapeHtml(res.path)}</span>
+                </a>
+                <span class="result-meta">${size} ${escapeHtml(date)}</span>
+            </li>
+        `);
+    }
+
     function getFileType(extension) {
         const ext = extension.toLowerCase();
         if (['jpg', 'jpeg', 'png', 'gif', 'bmp', 'svg'].includes(ext)) return 'image';
@@ -138,6 +394,10 @@ $(document).ready(function() {
         return 'binary';
     }
 
+    function hasThumbnail(fileName) {
+        return ['jpg', 'jpeg', 'png', 'gif'].includes(fileName.split('.').pop().toLowerCase());
+    }
+
     function getFileIcon(fileName) {
         const extension = fileName.split('.').pop();
         const type = getFileType(extension);
@@ -167,14 +427,17 @@ $(document).ready(function() {
             success: function(resp) {
                 hideLoading();
                 const mime = resp.mime;
-                if (mime.startsWith('text/')) {
-                    loadContent(item.path, 'text', mime);
+                const src = rawURL(item.path);
+                if (isTextMime(mime)) {
+                    loadText(item.path, 0);
                 } else if (mime.startsWith('image/')) {
-                    loadContent(item.path, 'blob', mime, 'image');
+                    showModal(`<img src="${src}" alt="${escapeHtml(item.name)}">`, item.path, item.name);
                 } else if (mime.startsWith('video/')) {
-                    loadContent(item.path, 'blob', mime, 'video');
+                    showModal(`<video controls preload="metadata" src="${src}"></video>`, item.path, item.name);
                 } else if (mime.startsWith('audio/')) {
-                    loadContent(item.path, 'blob', mime, 'audio');
+                    showModal(`<audio controls preload="metadata" src="${src}"></audio>`, item.path, item.name);
+                } else if (mime === 'application/pdf') {
+                    showModal(`<iframe class="pdf-frame" src="${src}" title="${escapeHtml(item.name)}"></iframe>`, item.path, item.name);
                 } else {
                     showModal("<p>Preview not available.</p>", item.path, item.name);
                 }
@@ -187,40 +450,64 @@ $(document).ready(function() {
         });
     }
 
-    function loadContent(filePath, responseType, mime, mediaType) {
+    function rawURL(filePath) {
+        return '/api/drive/raw?file=' + encodeURIComponent(filePath);
+    }
+
+    function isTextMime(mime) {
+        return mime.startsWith('text/') || mime === 'inode/x-empty' ||
+            ['application/json', 'application/xml', 'application/javascript', 'application/x-sh', 'application/x-shellscript'].includes(mime);
+    }
+
+    // テキストはチャンク単位で読み込み、続きは "Load more" で追加する。
+    // UTF-16 の BOM は先頭にしかないので、最初のチャンクのエンコーディングを渡す
+    function loadText(filePath, offset, encoding) {
         $.ajax({
-            url: '/api/drive/download',
+            url: '/api/drive/text',
             method: 'GET',
-            data: {file: filePath},
-            xhrFields: { responseType: responseType },
-            success: function(data) {
+            data: {file: filePath, offset: offset, encoding: encoding || ''},
+            dataType: 'json',
+            beforeSend: showLoading,
+            success: function(chunk) {
                 hideLoading();
-                if (responseType === 'text') {
-                    showModal(`<pre>${escapeHtml(data)}</pre>`, filePath, getFileName(filePath));
-                } else if (responseType === 'blob') {
-                    let blob = new Blob([data], {type: mime});
-                    let url = URL.createObjectURL(blob);
-                    let mediaElem = '';
-                    if (mediaType === 'image') {
-                        mediaElem = `<img src="${url}" alt="${escapeHtml(filePath)}">`;
-                    } else if (mediaType === 'video') {
-                        mediaElem = `<video controls src="${url}"></video>`;
-                    } else if (mediaType === 'audio') {
-                        mediaElem = `<audio controls src="${url}"></audio>`;
-                    }
-                    showModal(mediaElem, filePath, getFileName(filePath));
+                if (offset === 0) {
+                    showModal(`<pre><code class="language-${escapeHtml(chunk.language)}"></code></pre>`,
+                        filePath, getFileName(filePath), true);
+                }
+                previewArea.find('.load-more').remove();
+                previewArea.find('code').append(document.createTextNode(chunk.content));
+                if (!chunk.eof) {
+                    const more = $(`<button class="load-more">Load more (${formatBytes(chunk.next)} / ${formatBytes(chunk.size)})</button>`);
+                    more.click(function() {
+                        loadText(filePath, chunk.next, chunk.encoding);
+                    });
+                    previewArea.append(more);
                 }
             },
             error: function(err) {
                 hideLoading();
                 console.error("Content load failed:", err);
-                showModal("<p>Failed to load content.</p>", filePath, getFileName(filePath));
+                if (offset === 0) {
+                    showModal("<p>Failed to load content.</p>", filePath, getFileName(filePath));
+                }
             }
         });
     }
 
-    function showModal(contentHtml, filePath, fileName) {
-        downloadLink.html(`<a href="/api/drive/download?file=${encodeURIComponent(filePath)}" class="material-icons" title="Download">download</a>`);
+    function formatBytes(n) {
+        if (n < 1024) return n + ' B';
+        if (n < 1024 * 1024) return (n / 1024).toFixed(1) + ' KB';
+        return (n / 1024 / 1024).toFixed(1) + ' MB';
+    }
+
+    function showModal(contentHtml, filePath, fileName, isText) {
+        let links = `<a href="/api/drive/download?file=${encodeURIComponent(filePath)}" class="material-icons" title="Download">download</a>`;
+        if (isText) {
+            // テキストファイルは編集と tail -f での追跡ができる
+            links = `<a href="/edit?file=${encodeURIComponent(filePath)}" target="_blank" class="material-icons" title="Edit">edit</a>` +
+                `<a href="/tail?file=${encodeURIComponent(filePath)}" target="_blank" class="material-icons" title="Follow (tail -f)">receipt_long</a>` + links;
+        }
+        downloadLink.html(links);
         previewArea.html(contentHtml);
         modalFileName.text(fileName);
         previewModal.addClass('active');
@@ -0,0 +1,112 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const panel = document.querySelector('.editor-panel');
+    const editor = document.getElementById('editor');
+    const saveBtn = document.getElementById('saveBtn');
+    const reloadBtn = document.getElementById('reloadBtn');
+    const dirtyMark = document.getElementById('dirtyMark');
+    const fileInfo = document.getElementById('fileInfo');
+    const status = document.getElementById('status');
+
+    const file = panel.dataset.file;
+    // 読み込んだ時点のファイルの状態 (競合検出に使う)
+    let base = null;
+    let dirty = false;
+
+    loadFile();
+
+    function setDirty(value) {
+        dirty = value;
+        dirtyMark.textContent = dirty ? ' (modified)' : '';
+        saveBtn.disabled = !dirty || base === null;
+    }
+
+    function loadFile() {
+        status.textContent = 'Loading...';
+        fetch(`/api/drive/file?file=${encodeURIComponent(file)}`)
+            .then(async response => {
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || response.statusText);
+                return data;
+            })
+            .then(data => {
+                base = data;
+                editor.value = data.content;
+                editor.disabled = false;
+                showInfo();
+                setDirty(false);
+                status.textContent = '';
+            })
+            .catch(err => {
+                status.textContent = err.message;
+                editor.disabled = true;
+            });
+    }
+
+    function showInfo() {
+        fileInfo.textContent = `${base.encoding} · ${base.size} bytes · modified ${new Date(base.mtime * 1000).toLocaleString()}`;
+    }
+
+    function save(force) {
+        if (base === null) return;
+        status.textContent = 'Saving...';
+        saveBtn.disabled = true;
+        postJSON('/api/drive/file', {
+            file: file,
+            content: editor.value,
+            encoding: base.encoding,
+            base_size: base.size,
+            base_mtime: base.mtime,
+            base_hash: base.hash,
+            force: force
+        })
+            .then(data => {
+                base = Object.assign(base, data);
+                showInfo();
+                setDirty(false);
+                status.textContent = `Saved at ${new Date().toLocaleTimeString()}`;
+            })
+            .catch(err => {
+                setDirty(true);
+                if (err.status === 409) {
+                    status.textContent = 'The file changed on the server.';
+                    if (confirm('The file was changed on the server since you opened it.\nOverwrite it with your version?')) {
+                        save(true);
+                    }
+                    return;
+                }
+                status.textContent = err.message;
+            });
+    }
+
+    editor.addEventListener('input', () => setDirty(true));
+
+    editor.addEventListener('keydown', (e) => {
+        // Tab はフォーカス移動ではなく文字として挿入する
+        if (e.key === 'Tab' && !e.shiftKey) {
+            e.preventDefault();
+            editor.setRangeText('\t', editor.selectionStart, editor.selectionEnd, 'end');
+            setDirty(true);
+        }
+    });
+
+    document.addEventListener('keydown', (e) => {
+        if ((e.ctrlKey || e.metaKey) && e.key === 's') {
+            e.preventDefault();
+            if (dirty) save(false);
+        }
+    });
+
+    saveBtn.addEventListener('click', () => save(false));
+
+    reloadBtn.addEventListener('click', () => {
+        if (dirty && !confirm('Discard your changes and reload the file?')) return;
+        loadFile();
+    });
+
+    window.addEventListener('beforeunload', (e) => {
+        if (dirty) {
+            e.preventDefault();
+            e.returnValue = '';
+        }
+    });
+});
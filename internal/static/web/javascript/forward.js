@@ -0,0 +1,100 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const tunnelTable = document.getElementById('tunnelTable');
+    const openForm = document.getElementById('openForm');
+    const openStatus = document.getElementById('openStatus');
+    const kind = document.getElementById('kind');
+    const listen = document.getElementById('listen');
+    const target = document.getElementById('target');
+
+    const placeholders = {
+        local: ['127.0.0.1:8080', 'localhost:80'],
+        remote: ['127.0.0.1:9000', 'localhost:3000'],
+        dynamic: ['127.0.0.1:1080', '']
+    };
+
+    loadTunnels();
+    setInterval(loadTunnels, 2000);
+    updateForm();
+    kind.addEventListener('change', updateForm);
+
+    function updateForm() {
+        const [l, t] = placeholders[kind.value];
+        listen.placeholder = l;
+        target.placeholder = t;
+        target.disabled = kind.value === 'dynamic';
+        target.required = kind.value !== 'dynamic';
+    }
+
+    function formatBytes(n) {
+        const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+        let i = 0;
+        while (n >= 1024 && i < units.length - 1) {
+            n /= 1024;
+            i++;
+        }
+        return `${i === 0 ? n : n.toFixed(1)} ${units[i]}`;
+    }
+
+    function loadTunnels() {
+        fetch('/api/forward')
+            .then(response => response.json())
+            .then(renderTunnels)
+            .catch(err => console.error('Failed to load tunnels:', err));
+    }
+
+    function renderTunnels(tunnels) {
+        tunnelTable.innerHTML = '';
+        if (tunnels.length === 0) {
+            tunnelTable.innerHTML = '<tr><td colspan="7" class="muted">No active tunnels</td></tr>';
+            return;
+        }
+        tunnels.forEach(t => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td></td>
+                <td class="mono"></td>
+                <td class="mono"></td>
+                <td></td>
+                <td></td>
+                <td></td>
+                <td><button class="icon-btn" title="Close"><span class="material-icons">close</span></button></td>
+            `;
+            tr.children[0].textContent = t.kind;
+            tr.children[1].textContent = t.listen;
+            tr.children[2].textContent = t.kind === 'dynamic' ? 'SOCKS5' : t.target;
+            tr.children[3].textContent = `${t.active_conns} active / ${t.total_conns} total`;
+            tr.children[4].textContent = formatBytes(t.bytes_out);
+            tr.children[5].textContent = formatBytes(t.bytes_in);
+            tr.querySelector('button').addEventListener('click', () => {
+                postJSON('/api/forward/close', {id: t.id})
+                    .then(loadTunnels)
+                    .catch(err => alert(err.message));
+            });
+            tunnelTable.appendChild(tr);
+        });
+    }
+
+    const proxyForm = document.getElementById('proxyForm');
+    proxyForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        const port = document.getElementById('proxyPort').value;
+        window.open(`${proxyForm.dataset.base}${port}/`, '_blank', 'noopener');
+    });
+
+    openForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        openStatus.textContent = '';
+        postJSON('/api/forward/open', {
+            kind: kind.value,
+            listen: listen.value.trim(),
+            target: target.value.trim()
+        })
+            .then(t => {
+                openStatus.textContent = `Listening on ${t.listen}`;
+                listen.value = '';
+                target.value = '';
+                loadTunnels();
+            })
+            .catch(err => openStatus.textContent = err.message);
+    });
+});
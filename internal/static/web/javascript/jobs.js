@@ -0,0 +1,215 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const jobTable = document.getElementById('jobTable');
+    const historyPanel = document.getElementById('historyPanel');
+    const historyTitle = document.getElementById('historyTitle');
+    const historyTable = document.getElementById('historyTable');
+    const historyOutput = document.getElementById('historyOutput');
+    const editForm = document.getElementById('editForm');
+    const editTitle = document.getElementById('editTitle');
+    const editStatus = document.getElementById('editStatus');
+    const hostSelect = document.getElementById('editHost');
+
+    // 編集中のジョブID (新規の場合は空)
+    let editingID = '';
+    // 履歴を表示中のジョブ
+    let historyJob = null;
+
+    loadHosts();
+    loadJobs();
+    setInterval(() => {
+        loadJobs();
+        if (historyJob) loadHistory(historyJob);
+    }, 10000);
+
+    function loadHosts() {
+        fetch('/api/multi/hosts')
+            .then(response => response.json())
+            .then(hosts => {
+                hostSelect.innerHTML = '';
+                hosts.forEach(h => {
+                    const opt = document.createElement('option');
+                    opt.value = h.host;
+                    opt.textContent = `${h.user}@${h.host}`;
+                    hostSelect.appendChild(opt);
+                });
+            })
+            .catch(err => console.error('Failed to load hosts:', err));
+    }
+
+    function loadJobs() {
+        fetch('/api/jobs')
+            .then(response => response.json())
+            .then(renderJobs)
+            .catch(err => console.error('Failed to load jobs:', err));
+    }
+
+    function formatTime(t) {
+        return t ? new Date(t).toLocaleString() : '-';
+    }
+
+    function runStatus(run) {
+        if (!run) return {text: '-', cls: 'muted'};
+        const ok = !run.error && run.exit_code === 0;
+        return {
+            text: `${formatTime(run.started)} (${run.error ? 'error' : 'exit ' + run.exit_code})`,
+            cls: ok ? 'status-ok' : 'status-fail'
+        };
+    }
+
+    function renderJobs(jobs) {
+        jobTable.innerHTML = '';
+        if (jobs.length === 0) {
+            jobTable.innerHTML = '<tr><td colspan="7" class="muted">No jobs yet</td></tr>';
+            return;
+        }
+        jobs.forEach(job => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td></td>
+                <td class="mono"></td>
+                <td></td>
+                <td><pre class="mono"></pre></td>
+                <td></td>
+                <td></td>
+                <td>
+                    <button class="icon-btn run" title="Run now"><span class="material-icons">play_arrow</span></button>
+                    <button class="icon-btn history" title="History"><span class="material-icons">history</span></button>
+                    <button class="icon-btn edit" title="Edit"><span class="material-icons">edit</span></button>
+                    <button class="icon-btn delete" title="Delete"><span class="material-icons">delete</span></button>
+                </td>
+            `;
+            tr.children[0].textContent = job.name;
+            tr.children[1].textContent = job.schedule;
+            tr.children[2].textContent = job.host;
+            tr.querySelector('pre').textContent = job.command;
+            if (job.running) {
+                tr.children[4].textContent = 'running';
+                tr.children[4].className = 'status-ok';
+            } else if (job.enabled) {
+                tr.children[4].textContent = formatTime(job.next_run);
+            } else {
+                tr.children[4].textContent = 'disabled';
+                tr.children[4].className = 'muted';
+            }
+            const last = runStatus(job.last_run);
+            tr.children[5].textContent = last.text;
+            tr.children[5].className = last.cls;
+
+            tr.querySelector('.run').addEventListener('click', () => {
+                postJSON('/api/jobs/run', {id: job.id})
+                    .then(() => setTimeout(loadJobs, 500))
+                    .catch(err => alert(err.message));
+            });
+            tr.querySelector('.history').addEventListener('click', () => {
+                historyJob = job;
+                historyOutput.style.display = 'none';
+                loadHistory(job);
+                historyPanel.style.display = 'block';
+                historyPanel.scrollIntoView({behavior: 'smooth'});
+            });
+            tr.querySelector('.edit').addEventListener('click', () => openEdit(job));
+            tr.querySelector('.delete').addEventListener('click', () => {
+                if (!confirm(`Delete job "${job.name}"?`)) return;
+                postJSON('/api/jobs/delete', {id: job.id})
+                    .then(() => {
+                        if (historyJob && historyJob.id === job.id) {
+                            historyJob = null;
+                            historyPanel.style.display = 'none';
+                        }
+                        loadJobs();
+                    })
+                    .catch(err => alert(err.message));
+            });
+            jobTable.appendChild(tr);
+        });
+    }
+
+    function loadHistory(job) {
+        historyTitle.textContent = `History: ${job.name}`;
+        fetch(`/api/jobs/history?id=${encodeURIComponent(job.id)}`)
+            .then(response => response.json())
+            .then(runs => {
+                historyTable.innerHTML = '';
+                if (!Array.isArray(runs) || runs.length === 0) {
+                    historyTable.innerHTML = '<tr><td colspan="5" class="muted">No runs yet</td></tr>';
+                    return;
+                }
+                runs.forEach(run => {
+                    const tr = document.createElement('tr');
+                    tr.innerHTML = `
+                        <td></td><td></td><td></td><td></td>
+                        <td><button class="icon-btn" title="Output"><span class="material-icons">article</span></button></td>
+                    `;
+                    tr.children[0].textContent = formatTime(run.started) + (run.manual ? ' (manual)' : '');
+                    tr.children[1].textContent = run.attempt;
+                    tr.children[2].textContent = run.error ? 'error' : run.exit_code;
+                    tr.children[2].className = !run.error && run.exit_code === 0 ? 'status-ok' : 'status-fail';
+                    tr.children[3].textContent = `${run.duration_ms} ms`;
+                    tr.querySelector('button').addEventListener('click', () => showOutput(run));
+                    historyTable.appendChild(tr);
+                });
+            })
+            .catch(err => console.error('Failed to load history:', err));
+    }
+
+    function showOutput(run) {
+        historyOutput.innerHTML = '';
+        const append = (text, cls) => {
+            const line = document.createElement('div');
+            line.textContent = text;
+            if (cls) line.className = cls;
+            historyOutput.appendChild(line);
+        };
+        append(`${formatTime(run.started)} attempt ${run.attempt}`, 'meta');
+        if (run.stdout) append(run.stdout);
+        if (run.stderr) append(run.stderr, 'stderr');
+        if (run.error) append(run.error, 'stderr');
+        append(`[exit ${run.exit_code}]`, 'meta');
+        historyOutput.style.display = 'block';
+    }
+
+    function openEdit(job) {
+        editingID = job.id;
+        editTitle.textContent = `Edit job: ${job.name}`;
+        document.getElementById('editName').value = job.name;
+        document.getElementById('editSchedule').value = job.schedule;
+        hostSelect.value = job.host;
+        document.getElementById('editCommand').value = job.command;
+        document.getElementById('editRetries').value = job.retries;
+        document.getElementById('editRetryDelay').value = job.retry_delay;
+        document.getElementById('editTimeout').value = job.timeout === '0s' ? '' : job.timeout;
+        document.getElementById('editEnabled').checked = job.enabled;
+        editForm.scrollIntoView({behavior: 'smooth'});
+    }
+
+    function resetEdit() {
+        editingID = '';
+        editTitle.textContent = 'New job';
+        editForm.reset();
+        editStatus.textContent = '';
+    }
+
+    document.getElementById('editReset').addEventListener('click', resetEdit);
+
+    editForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        const body = {
+            id: editingID,
+            name: document.getElementById('editName').value.trim(),
+            schedule: document.getElementById('editSchedule').value.trim(),
+            host: hostSelect.value,
+            command: document.getElementById('editCommand').value.trim(),
+            retries: parseInt(document.getElementById('editRetries').value, 10) || 0,
+            retry_delay: document.getElementById('editRetryDelay').value.trim() || '30s',
+            timeout: document.getElementById('editTimeout').value.trim() || '0s',
+            enabled: document.getElementById('editEnabled').checked
+        };
+        postJSON('/api/jobs/save', body)
+            .then(() => {
+                resetEdit();
+                editStatus.textContent = 'Saved.';
+                loadJobs();
+            })
+            .catch(err => editStatus.textContent = err.message);
+    });
+});
@@ -0,0 +1,139 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const status = document.getElementById('status');
+    const diskTable = document.getElementById('diskTable');
+
+    // 表示するサンプル数 (サーバー側の保持数と同じ)
+    const maxSamples = 150;
+    let samples = [];
+
+    const wsProtocol = location.protocol === 'https:' ? 'wss://' : 'ws://';
+    const socket = new WebSocket(`${wsProtocol}${window.location.host}/monitor/ws`);
+
+    socket.onopen = () => {
+        status.textContent = 'Waiting for data...';
+    };
+
+    socket.onmessage = (event) => {
+        const msg = JSON.parse(event.data);
+        switch (msg.type) {
+            case 'history':
+                samples = msg.samples || [];
+                break;
+            case 'sample':
+                samples.push(msg.sample);
+                if (samples.length > maxSamples) samples.shift();
+                break;
+            case 'error':
+                status.textContent = `Error: ${msg.message}`;
+                return;
+        }
+        render();
+    };
+
+    socket.onclose = () => {
+        status.textContent = 'Disconnected';
+    };
+
+    window.addEventListener('resize', render);
+
+    function formatBytes(n) {
+        const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+        let i = 0;
+        while (n >= 1024 && i < units.length - 1) {
+            n /= 1024;
+            i++;
+        }
+        return `${i === 0 ? n.toFixed(0) : n.toFixed(1)} ${units[i]}`;
+    }
+
+    function percent(used, total) {
+        return total > 0 ? used / total * 100 : 0;
+    }
+
+    // drawChart は series ([{values, color}]) を折れ線で描画する
+    function drawChart(canvas, series, maxValue) {
+        const ratio = window.devicePixelRatio || 1;
+        const width = canvas.clientWidth;
+        const height = canvas.clientHeight;
+        canvas.width = width * ratio;
+        canvas.height = height * ratio;
+        const ctx = canvas.getContext('2d');
+        ctx.scale(ratio, ratio);
+        ctx.clearRect(0, 0, width, height);
+
+        // グリッド
+        ctx.strokeStyle = 'rgba(255, 255, 255, 0.08)';
+        ctx.lineWidth = 1;
+        for (let i = 1; i < 4; i++) {
+            const y = Math.round(height * i / 4) + 0.5;
+            ctx.beginPath();
+            ctx.moveTo(0, y);
+            ctx.lineTo(width, y);
+            ctx.stroke();
+        }
+
+        const max = maxValue || Math.max(1, ...series.flatMap(s => s.values));
+        const step = width / (maxSamples - 1);
+        series.forEach(s => {
+            const offset = maxSamples - s.values.length;
+            ctx.strokeStyle = s.color;
+            ctx.lineWidth = 1.5;
+            ctx.beginPath();
+            s.values.forEach((v, i) => {
+                const x = (offset + i) * step;
+                const y = height - Math.min(v / max, 1) * (height - 2) - 1;
+                if (i === 0) ctx.moveTo(x, y);
+                else ctx.lineTo(x, y);
+            });
+            ctx.stroke();
+        });
+    }
+
+    function render() {
+        if (samples.length === 0) return;
+        const last = samples[samples.length - 1];
+        status.textContent = `Updated ${new Date(last.time).toLocaleTimeString()}`;
+
+        document.getElementById('cpuValue').textContent = `${last.cpu.toFixed(1)}%`;
+        document.getElementById('loadValue').textContent = `load ${last.load.map(v => v.toFixed(2)).join(' ')}`;
+        drawChart(document.getElementById('cpuChart'), [
+            {values: samples.map(s => s.cpu), color: '#F893FD'}
+        ], 100);
+
+        document.getElementById('memValue').textContent =
+            `${formatBytes(last.mem_used)} / ${formatBytes(last.mem_total)}`;
+        document.getElementById('swapValue').textContent = last.swap_total > 0
+            ? `swap ${formatBytes(last.swap_used)} / ${formatBytes(last.swap_total)}`
+            : 'swap none';
+        drawChart(document.getElementById('memChart'), [
+            {values: samples.map(s => percent(s.mem_used, s.mem_total)), color: '#AAAAFB'}
+        ], 100);
+
+        document.getElementById('netValue').textContent =
+            `↓ ${formatBytes(last.net_rx)}/s ↑ ${formatBytes(last.net_tx)}/s`;
+        drawChart(document.getElementById('netChart'), [
+            {values: samples.map(s => s.net_rx), color: '#A9FA9E'},
+            {values: samples.map(s => s.net_tx), color: '#F893FD'}
+        ]);
+
+        diskTable.innerHTML = '';
+        last.disks.forEach(d => {
+            const usage = percent(d.used, d.total);
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td class="mono"></td>
+                <td></td>
+                <td></td>
+                <td><div class="usage-bar"><div></div></div> <span class="muted"></span></td>
+            `;
+            tr.children[0].textContent = d.mount;
+            tr.children[1].textContent = formatBytes(d.used);
+            tr.children[2].textContent = formatBytes(d.total);
+            const bar = tr.querySelector('.usage-bar');
+            bar.firstElementChild.style.width = `${usage.toFixed(1)}%`;
+            if (usage >= 90) bar.classList.add('high');
+            tr.querySelector('span').textContent = `${usage.toFixed(0)}%`;
+            diskTable.appendChild(tr);
+        });
+    }
+});
@@ -0,0 +1,160 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const hostTable = document.getElementById('hostTable');
+    const tagSelect = document.getElementById('tagSelect');
+    const form = document.getElementById('runForm');
+    const input = document.getElementById('commandInput');
+    const runBtn = document.getElementById('runBtn');
+    const status = document.getElementById('status');
+    const resultsPanel = document.getElementById('resultsPanel');
+    const resultTable = document.getElementById('resultTable');
+    const exportBar = document.getElementById('exportBar');
+
+    let hosts = [];
+
+    fetch('/api/multi/hosts')
+        .then(response => response.json())
+        .then(data => {
+            hosts = data;
+            renderHosts();
+        })
+        .catch(err => {
+            console.error('Failed to load saved hosts:', err);
+            status.textContent = 'Failed to load saved hosts.';
+        });
+
+    function renderHosts() {
+        hostTable.innerHTML = '';
+        const tags = new Set();
+        if (hosts.length === 0) {
+            hostTable.innerHTML = '<tr><td colspan="5" class="muted">No saved connections available</td></tr>';
+        }
+        hosts.forEach(h => {
+            (h.tags || []).forEach(t => tags.add(t));
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td><input type="checkbox" value="${escapeHtml(h.host)}"></td>
+                <td>${escapeHtml(h.host)}</td>
+                <td>${escapeHtml(h.user)}</td>
+                <td>${h.port}</td>
+                <td class="muted">${escapeHtml((h.tags || []).join(', '))}</td>
+            `;
+            hostTable.appendChild(tr);
+        });
+        [...tags].sort().forEach(t => {
+            const opt = document.createElement('option');
+            opt.value = t;
+            opt.textContent = t;
+            tagSelect.appendChild(opt);
+        });
+    }
+
+    function checkboxes() {
+        return [...hostTable.querySelectorAll('input[type="checkbox"]')];
+    }
+
+    tagSelect.addEventListener('change', () => {
+        const tag = tagSelect.value;
+        if (tag === '') return;
+        checkboxes().forEach(cb => {
+            const host = hosts.find(h => h.host === cb.value);
+            cb.checked = (host.tags || []).includes(tag);
+        });
+    });
+
+    document.getElementById('selectAllBtn').addEventListener('click', () => {
+        checkboxes().forEach(cb => cb.checked = true);
+    });
+
+    document.getElementById('selectNoneBtn').addEventListener('click', () => {
+        checkboxes().forEach(cb => cb.checked = false);
+        tagSelect.value = '';
+    });
+
+    form.addEventListener('submit', (e) => {
+        e.preventDefault();
+        const selected = checkboxes().filter(cb => cb.checked).map(cb => cb.value);
+        if (selected.length === 0) {
+            status.textContent = 'Select at least one host.';
+            return;
+        }
+        runBtn.disabled = true;
+        status.textContent = `Running on ${selected.length} host(s)...`;
+        runCommand({command: input.value, hosts: selected})
+            .catch(err => {
+                status.textContent = `Run failed: ${err.message}`;
+            })
+            .finally(() => {
+                runBtn.disabled = false;
+            });
+    });
+
+    // 結果は NDJSON でホストごとに届くので、終わったホストから表示する
+    async function runCommand(body) {
+        const response = await fetch('/api/multi/run', {
+            method: 'POST',
+            headers: {'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken},
+            body: JSON.stringify(body)
+        });
+        if (!response.ok) {
+            const data = await response.json().catch(() => ({}));
+            throw new Error(data.error || response.statusText);
+        }
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buf = '';
+        let total = 0;
+        let finished = 0;
+        for (;;) {
+            const {value, done} = await reader.read();
+            if (done) break;
+            buf += decoder.decode(value, {stream: true});
+            let nl;
+            while ((nl = buf.indexOf('\n')) >= 0) {
+                const line = buf.slice(0, nl);
+                buf = buf.slice(nl + 1);
+                if (!line) continue;
+                const msg = JSON.parse(line);
+                if (msg.done) {
+                    status.textContent = `Finished: ${msg.succeeded}/${msg.total} succeeded`;
+                    exportBar.style.display = '';
+                } else if (msg.id) {
+                    total = msg.hosts;
+                    startResults(msg);
+                } else {
+                    finished++;
+                    addResult(msg);
+                    status.textContent = `Running... ${finished}/${total} host(s) finished`;
+                }
+            }
+        }
+    }
+
+    function startResults(run) {
+        resultsPanel.style.display = 'block';
+        exportBar.style.display = 'none';
+        document.getElementById('exportJson').href = `/api/multi/export?id=${run.id}&format=json`;
+        document.getElementById('exportCsv').href = `/api/multi/export?id=${run.id}&format=csv`;
+        resultTable.innerHTML = '';
+    }
+
+    function addResult(res) {
+        const ok = res.exit_code === 0 && !res.error;
+        const output = res.error ? res.error : (res.stdout + res.stderr);
+        const tr = document.createElement('tr');
+        tr.innerHTML = `
+            <td>${escapeHtml(res.user)}@${escapeHtml(res.host)}</td>
+            <td class="${ok ? 'status-ok' : 'status-fail'}">${res.exit_code}</td>
+            <td>${(res.duration_ms / 1000).toFixed(2)}s</td>
+            <td><pre class="mono">${escapeHtml(output)}</pre></td>
+        `;
+        resultTable.appendChild(tr);
+    }
+
+    function escapeHtml(str) {
+        if (!str) return '';
+        return str.replace(/&/g, '&amp;')
+            .replace(/</g, '&lt;')
+            .replace(/>/g, '&gt;')
+            .replace(/"/g, '&quot;');
+    }
+});
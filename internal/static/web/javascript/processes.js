@@ -0,0 +1,143 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const processTable = document.getElementById('processTable');
+    const filterInput = document.getElementById('filterInput');
+    const autoRefresh = document.getElementById('autoRefresh');
+    const selectAll = document.getElementById('selectAll');
+    const selectionInfo = document.getElementById('selectionInfo');
+    const signalStatus = document.getElementById('signalStatus');
+    const signalButtons = document.querySelectorAll('.signal-btn');
+
+    let sortKey = 'cpu';
+    let order = 'desc';
+    // 選択中の PID (再描画後も保持する)
+    const selected = new Set();
+    let filterTimer = null;
+
+    loadProcesses();
+    setInterval(() => {
+        if (autoRefresh.checked) loadProcesses();
+    }, 3000);
+
+    document.getElementById('refreshBtn').addEventListener('click', loadProcesses);
+
+    filterInput.addEventListener('input', () => {
+        clearTimeout(filterTimer);
+        filterTimer = setTimeout(loadProcesses, 300);
+    });
+
+    document.querySelectorAll('th.sortable').forEach(th => {
+        th.addEventListener('click', () => {
+            if (sortKey === th.dataset.sort) {
+                order = order === 'desc' ? 'asc' : 'desc';
+            } else {
+                sortKey = th.dataset.sort;
+                order = ['user', 'command', 'pid'].includes(sortKey) ? 'asc' : 'desc';
+            }
+            loadProcesses();
+        });
+    });
+
+    selectAll.addEventListener('change', () => {
+        processTable.querySelectorAll('input[type="checkbox"]').forEach(cb => {
+            cb.checked = selectAll.checked;
+            const pid = Number(cb.dataset.pid);
+            if (selectAll.checked) selected.add(pid);
+            else selected.delete(pid);
+        });
+        updateSelection();
+    });
+
+    signalButtons.forEach(btn => {
+        btn.addEventListener('click', () => {
+            const pids = Array.from(selected);
+            const signal = btn.dataset.signal;
+            if (!confirm(`Send SIG${signal} to ${pids.length} process(es)?`)) return;
+            postJSON('/api/processes/signal', {pids, signal})
+                .then(results => {
+                    const failed = results.filter(r => !r.ok);
+                    signalStatus.textContent = failed.length === 0
+                        ? `SIG${signal} sent to ${results.length} process(es)`
+                        : failed.map(r => `${r.pid}: ${r.error}`).join(', ');
+                    selected.clear();
+                    selectAll.checked = false;
+                    loadProcesses();
+                })
+                .catch(err => signalStatus.textContent = err.message);
+        });
+    });
+
+    function updateSelection() {
+        selectionInfo.textContent = selected.size === 0
+            ? 'No processes selected'
+            : `${selected.size} selected`;
+        signalButtons.forEach(btn => btn.disabled = selected.size === 0);
+    }
+
+    function formatBytes(n) {
+        const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+        let i = 0;
+        while (n >= 1024 && i < units.length - 1) {
+            n /= 1024;
+            i++;
+        }
+        return `${i === 0 ? n : n.toFixed(1)} ${units[i]}`;
+    }
+
+    function loadProcesses() {
+        const params = new URLSearchParams({filter: filterInput.value.trim(), sort: sortKey, order});
+        fetch(`/api/processes?${params}`)
+            .then(response => response.json())
+            .then(renderProcesses)
+            .catch(err => console.error('Failed to load processes:', err));
+    }
+
+    function renderProcesses(procs) {
+        if (!Array.isArray(procs)) {
+            processTable.innerHTML = `<tr><td colspan="8" class="status-fail"></td></tr>`;
+            processTable.querySelector('td').textContent = procs.error || 'Failed to load processes';
+            return;
+        }
+        // 一覧から消えたプロセスは選択から外す
+        const pids = new Set(procs.map(p => p.pid));
+        selected.forEach(pid => {
+            if (!pids.has(pid)) selected.delete(pid);
+        });
+
+        processTable.innerHTML = '';
+        procs.forEach(p => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td><input type="checkbox"></td>
+                <td class="mono"></td>
+                <td></td>
+                <td></td>
+                <td></td>
+                <td></td>
+                <td></td>
+                <td class="mono"></td>
+            `;
+            const cb = tr.querySelector('input');
+            cb.dataset.pid = p.pid;
+            cb.checked = selected.has(p.pid);
+            cb.addEventListener('change', () => {
+                if (cb.checked) selected.add(p.pid);
+                else selected.delete(p.pid);
+                updateSelection();
+            });
+            tr.children[1].textContent = p.pid;
+            tr.children[2].textContent = p.user;
+            tr.children[3].textContent = p.cpu.toFixed(1);
+            tr.children[4].textContent = p.mem.toFixed(1);
+            tr.children[5].textContent = formatBytes(p.rss);
+            tr.children[6].textContent = new Date(p.started).toLocaleString();
+            tr.children[7].textContent = p.command;
+            processTable.appendChild(tr);
+        });
+
+        document.querySelectorAll('th.sortable').forEach(th => {
+            th.classList.toggle('sorted', th.dataset.sort === sortKey);
+            th.dataset.order = th.dataset.sort === sortKey ? order : '';
+        });
+        updateSelection();
+    }
+});
@@ -0,0 +1,87 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const form = document.getElementById('runForm');
+    const input = document.getElementById('commandInput');
+    const runBtn = document.getElementById('runBtn');
+    const interruptBtn = document.getElementById('interruptBtn');
+    const killBtn = document.getElementById('killBtn');
+    const clearBtn = document.getElementById('clearBtn');
+    const output = document.getElementById('output');
+    const status = document.getElementById('status');
+
+    const wsProtocol = location.protocol === 'https:' ? 'wss://' : 'ws://';
+    const socket = new WebSocket(`${wsProtocol}${window.location.host}/run/ws`);
+
+    function setRunning(running) {
+        runBtn.disabled = running;
+        input.disabled = running;
+        interruptBtn.disabled = !running;
+        killBtn.disabled = !running;
+    }
+
+    function appendLine(text, cls) {
+        const atBottom = output.scrollTop + output.clientHeight >= output.scrollHeight - 4;
+        const line = document.createElement('div');
+        line.textContent = text;
+        if (cls) line.className = cls;
+        output.appendChild(line);
+        if (atBottom) output.scrollTop = output.scrollHeight;
+    }
+
+    socket.onopen = () => {
+        status.textContent = 'Ready';
+        setRunning(false);
+    };
+
+    socket.onmessage = (event) => {
+        const msg = JSON.parse(event.data);
+        switch (msg.type) {
+            case 'started':
+                appendLine(`$ ${msg.command}`, 'meta');
+                status.textContent = 'Running...';
+                setRunning(true);
+                break;
+            case 'line':
+                appendLine(msg.data, msg.stream === 'stderr' ? 'stderr' : '');
+                break;
+            case 'exit':
+                const seconds = (msg.duration_ms / 1000).toFixed(1);
+                appendLine(`[exit ${msg.code}, ${seconds}s]${msg.message ? ' ' + msg.message : ''}`, 'meta');
+                status.textContent = `Exited with ${msg.code}`;
+                setRunning(false);
+                input.focus();
+                break;
+            case 'error':
+                appendLine(msg.message, 'stderr');
+                break;
+        }
+    };
+
+    socket.onclose = () => {
+        status.textContent = 'Connection to the server closed.';
+        runBtn.disabled = true;
+        interruptBtn.disabled = true;
+        killBtn.disabled = true;
+    };
+
+    form.addEventListener('submit', (e) => {
+        e.preventDefault();
+        const command = input.value.trim();
+        if (command === '' || socket.readyState !== WebSocket.OPEN) return;
+        socket.send(JSON.stringify({type: 'start', command: command}));
+    });
+
+    interruptBtn.addEventListener('click', () => {
+        socket.send(JSON.stringify({type: 'signal', signal: 'INT'}));
+    });
+
+    killBtn.addEventListener('click', () => {
+        socket.send(JSON.stringify({type: 'signal', signal: 'KILL'}));
+    });
+
+    clearBtn.addEventListener('click', () => {
+        output.innerHTML = '';
+    });
+
+    setRunning(true);
+    runBtn.disabled = true;
+});
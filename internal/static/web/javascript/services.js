@@ -0,0 +1,102 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const unitTable = document.getElementById('unitTable');
+    const filterInput = document.getElementById('filterInput');
+    const stateFilter = document.getElementById('stateFilter');
+    const status = document.getElementById('status');
+
+    let units = [];
+
+    const actions = [
+        {action: 'start', icon: 'play_arrow', title: 'Start'},
+        {action: 'stop', icon: 'stop', title: 'Stop'},
+        {action: 'restart', icon: 'restart_alt', title: 'Restart'},
+        {action: 'enable', icon: 'toggle_on', title: 'Enable'},
+        {action: 'disable', icon: 'toggle_off', title: 'Disable'}
+    ];
+
+    loadUnits();
+    document.getElementById('refreshBtn').addEventListener('click', loadUnits);
+    filterInput.addEventListener('input', renderUnits);
+    stateFilter.addEventListener('change', renderUnits);
+
+    function loadUnits() {
+        status.textContent = 'Loading...';
+        fetch('/api/services')
+            .then(async response => {
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || response.statusText);
+                return data;
+            })
+            .then(list => {
+                units = list;
+                status.textContent = '';
+                renderUnits();
+            })
+            .catch(err => status.textContent = err.message);
+    }
+
+    function stateClass(active) {
+        if (active === 'active') return 'status-ok';
+        if (active === 'failed') return 'status-fail';
+        return 'muted';
+    }
+
+    function renderUnits() {
+        const filter = filterInput.value.trim().toLowerCase();
+        const state = stateFilter.value;
+        const shown = units.filter(u =>
+            (!filter || u.name.toLowerCase().includes(filter) || u.description.toLowerCase().includes(filter)) &&
+            (!state || u.active === state));
+
+        unitTable.innerHTML = '';
+        if (shown.length === 0) {
+            unitTable.innerHTML = '<tr><td colspan="5" class="muted">No units</td></tr>';
+            return;
+        }
+        shown.forEach(u => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td class="mono"></td>
+                <td></td>
+                <td class="muted"></td>
+                <td class="muted"></td>
+                <td class="unit-actions"></td>
+            `;
+            tr.children[0].textContent = u.name;
+            tr.children[1].textContent = `${u.active} (${u.sub})`;
+            tr.children[1].className = stateClass(u.active);
+            tr.children[2].textContent = u.unit_file_state || '-';
+            tr.children[3].textContent = u.description;
+
+            const cell = tr.children[4];
+            actions.forEach(a => {
+                const btn = document.createElement('button');
+                btn.className = 'icon-btn';
+                btn.title = a.title;
+                btn.innerHTML = `<span class="material-icons">${a.icon}</span>`;
+                btn.addEventListener('click', () => runAction(u.name, a.action));
+                cell.appendChild(btn);
+            });
+            const journal = document.createElement('a');
+            journal.className = 'icon-btn';
+            journal.title = 'Journal';
+            journal.target = '_blank';
+            journal.href = `/services/journal?unit=${encodeURIComponent(u.name)}`;
+            journal.innerHTML = '<span class="material-icons">receipt_long</span>';
+            cell.appendChild(journal);
+
+            unitTable.appendChild(tr);
+        });
+    }
+
+    function runAction(unit, action) {
+        if (['stop', 'restart', 'disable'].includes(action) && !confirm(`${action} ${unit}?`)) return;
+        status.textContent = `Running systemctl ${action} ${unit}...`;
+        postJSON('/api/services/action', {unit, action})
+            .then(() => {
+                status.textContent = `systemctl ${action} ${unit}: done`;
+                loadUnits();
+            })
+            .catch(err => status.textContent = `systemctl ${action} ${unit}: ${err.message}`);
+    }
+});
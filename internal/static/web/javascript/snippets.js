@@ -0,0 +1,149 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const snippetTable = document.getElementById('snippetTable');
+    const runbookTable = document.getElementById('runbookTable');
+    const runPanel = document.getElementById('runPanel');
+    const runTitle = document.getElementById('runTitle');
+    const varsGrid = document.getElementById('varsGrid');
+    const varsForm = document.getElementById('varsForm');
+    const runOutput = document.getElementById('runOutput');
+    const editForm = document.getElementById('editForm');
+    const editStatus = document.getElementById('editStatus');
+
+    // 実行対象 {kind, item}
+    let current = null;
+
+    loadLibrary();
+
+    function loadLibrary() {
+        fetch('/api/snippets')
+            .then(response => response.json())
+            .then(renderLibrary)
+            .catch(err => console.error('Failed to load snippets:', err));
+    }
+
+    function renderLibrary(lib) {
+        snippetTable.innerHTML = '';
+        runbookTable.innerHTML = '';
+        if (lib.snippets.length === 0) {
+            snippetTable.innerHTML = '<tr><td colspan="4" class="muted">No snippets yet</td></tr>';
+        }
+        if (lib.runbooks.length === 0) {
+            runbookTable.innerHTML = '<tr><td colspan="4" class="muted">No runbooks yet</td></tr>';
+        }
+        lib.snippets.forEach(s => {
+            snippetTable.appendChild(row(s.name, s.command, s.description, 'snippet', s));
+        });
+        lib.runbooks.forEach(rb => {
+            const steps = rb.steps.map((st, i) => `${i + 1}. ${st.command}`).join('\n');
+            runbookTable.appendChild(row(rb.name, steps, rb.description, 'runbook', rb));
+        });
+    }
+
+    function row(name, command, description, kind, item) {
+        const tr = document.createElement('tr');
+        tr.innerHTML = `
+            <td></td>
+            <td><pre class="mono"></pre></td>
+            <td class="muted"></td>
+            <td>
+                <button class="icon-btn run" title="Run"><span class="material-icons">play_arrow</span></button>
+                <button class="icon-btn delete" title="Delete"><span class="material-icons">delete</span></button>
+            </td>
+        `;
+        tr.children[0].textContent = name;
+        tr.querySelector('pre').textContent = command;
+        tr.children[2].textContent = description || '';
+        tr.querySelector('.run').addEventListener('click', () => openRun(kind, item));
+        tr.querySelector('.delete').addEventListener('click', () => {
+            if (!confirm(`Delete ${kind} "${name}"?`)) return;
+            postJSON('/api/snippets/delete', {kind: kind, name: name})
+                .then(loadLibrary)
+                .catch(err => alert(err.message));
+        });
+        return tr;
+    }
+
+    function openRun(kind, item) {
+        current = {kind, item};
+        runTitle.textContent = `${kind === 'runbook' ? 'Runbook' : 'Snippet'}: ${item.name}`;
+        varsGrid.innerHTML = '';
+        item.variables.forEach(v => {
+            const label = document.createElement('label');
+            label.textContent = v;
+            const input = document.createElement('input');
+            input.type = 'text';
+            input.name = v;
+            input.required = true;
+            varsGrid.appendChild(label);
+            varsGrid.appendChild(input);
+        });
+        runOutput.innerHTML = '';
+        runPanel.style.display = 'block';
+        runPanel.scrollIntoView({behavior: 'smooth'});
+    }
+
+    function appendLine(text, cls) {
+        const line = document.createElement('div');
+        line.textContent = text;
+        if (cls) line.className = cls;
+        runOutput.appendChild(line);
+    }
+
+    varsForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        if (!current) return;
+        const vars = {};
+        varsGrid.querySelectorAll('input').forEach(input => vars[input.name] = input.value);
+        runOutput.innerHTML = '';
+        appendLine('Running...', 'meta');
+
+        if (current.kind === 'runbook') {
+            postJSON('/api/runbooks/run', {name: current.item.name, vars: vars})
+                .then(result => {
+                    runOutput.innerHTML = '';
+                    result.steps.forEach((st, i) => {
+                        const title = `${i + 1}. ${st.name || ''} $ ${st.command}`;
+                        if (st.skipped) {
+                            appendLine(`${title} [skipped]`, 'meta');
+                            return;
+                        }
+                        appendLine(title, 'meta');
+                        if (st.stdout) appendLine(st.stdout);
+                        if (st.stderr) appendLine(st.stderr, 'stderr');
+                        if (st.error) appendLine(st.error, 'stderr');
+                        appendLine(`[exit ${st.exit_code}]`, st.exit_code === 0 ? 'meta' : 'stderr');
+                    });
+                    appendLine(result.ok ? 'Runbook completed.' : 'Runbook stopped on failure.', result.ok ? 'meta' : 'stderr');
+                })
+                .catch(err => appendLine(err.message, 'stderr'));
+        } else {
+            postJSON('/api/snippets/run', {name: current.item.name, vars: vars})
+                .then(result => {
+                    runOutput.innerHTML = '';
+                    appendLine(`$ ${result.command}`, 'meta');
+                    if (result.stdout) appendLine(result.stdout);
+                    if (result.stderr) appendLine(result.stderr, 'stderr');
+                    appendLine(`[exit ${result.exit_code}]`, 'meta');
+                })
+                .catch(err => appendLine(err.message, 'stderr'));
+        }
+    });
+
+    editForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        const name = document.getElementById('editName').value.trim();
+        const description = document.getElementById('editDescription').value.trim();
+        const lines = document.getElementById('editCommand').value
+            .split('\n').map(l => l.trim()).filter(l => l !== '');
+        const body = lines.length > 1
+            ? {runbook: {name, description, steps: lines.map(c => ({name: '', command: c}))}}
+            : {snippet: {name, description, command: lines[0] || ''}};
+        postJSON('/api/snippets/save', body)
+            .then(() => {
+                editStatus.textContent = 'Saved.';
+                editForm.reset();
+                loadLibrary();
+            })
+            .catch(err => editStatus.textContent = err.message);
+    });
+});
@@ -0,0 +1,85 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const filterForm = document.getElementById('filterForm');
+    const filterInput = document.getElementById('filterInput');
+    const regexInput = document.getElementById('regexInput');
+    const pauseBtn = document.getElementById('pauseBtn');
+    const followInput = document.getElementById('followInput');
+    const output = document.getElementById('output');
+    const status = document.getElementById('status');
+
+    // 画面に保持する最大行数
+    const maxLines = 5000;
+    let paused = false;
+
+    const wsProtocol = location.protocol === 'https:' ? 'wss://' : 'ws://';
+    const socket = new WebSocket(`${wsProtocol}${window.location.host}${filterForm.dataset.source}`);
+
+    function send(msg) {
+        if (socket.readyState === WebSocket.OPEN) {
+            socket.send(JSON.stringify(msg));
+        }
+    }
+
+    function appendLine(text, cls) {
+        const line = document.createElement('div');
+        line.textContent = text;
+        if (cls) line.className = cls;
+        output.appendChild(line);
+        while (output.childElementCount > maxLines) {
+            output.removeChild(output.firstElementChild);
+        }
+        if (followInput.checked) output.scrollTop = output.scrollHeight;
+    }
+
+    socket.onopen = () => {
+        status.textContent = 'Following';
+    };
+
+    socket.onmessage = (event) => {
+        const msg = JSON.parse(event.data);
+        switch (msg.type) {
+            case 'started':
+                status.textContent = `Following ${msg.data}`;
+                break;
+            case 'line':
+                if (msg.stream === 'stderr') {
+                    appendLine(msg.data, 'meta');
+                } else {
+                    appendLine(msg.data, msg.level ? `level-${msg.level}` : '');
+                }
+                break;
+            case 'dropped':
+                appendLine(`[${msg.count} lines dropped while paused]`, 'meta');
+                break;
+            case 'error':
+                appendLine(msg.message, 'stderr');
+                break;
+            case 'exit':
+                status.textContent = `Exited${msg.message ? ': ' + msg.message : ''}`;
+                break;
+        }
+    };
+
+    socket.onclose = () => {
+        status.textContent = 'Disconnected';
+        pauseBtn.disabled = true;
+    };
+
+    filterForm.addEventListener('submit', (e) => {
+        e.preventDefault();
+        send({type: 'filter', pattern: filterInput.value, regex: regexInput.checked});
+        appendLine(filterInput.value ? `[filter: ${filterInput.value}]` : '[filter cleared]', 'meta');
+    });
+
+    pauseBtn.addEventListener('click', () => {
+        paused = !paused;
+        send({type: paused ? 'pause' : 'resume'});
+        pauseBtn.querySelector('.material-icons').textContent = paused ? 'play_arrow' : 'pause';
+        pauseBtn.querySelector('span:last-child').textContent = paused ? 'Resume' : 'Pause';
+        status.textContent = paused ? 'Paused' : 'Following';
+    });
+
+    document.getElementById('clearBtn').addEventListener('click', () => {
+        output.innerHTML = '';
+    });
+});
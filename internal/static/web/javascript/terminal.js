@@ -16,7 +16,7 @@ document.addEventListener('DOMContentLoaded', () => {
     term.open(terminalElement);
 
     const wsProtocol = location.protocol === 'https:' ? 'wss://' : 'ws://';
-    let socket = new WebSocket(`${wsProtocol}${window.location.host}/terminal/ws`);
+    let socket = new WebSocket(`${wsProtocol}${window.location.host}${terminalElement.dataset.socket}`);
     socket.binaryType = 'arraybuffer'; // 追加
 
     const setupSocket = () => {
@@ -64,7 +64,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
         if (data === '\r') { // エンターキーが押された場合
             const command = inputBuffer.trim(); // 入力コマンドを取得
-            if (command === 'exit') {
+            if (command === 'exit' && terminalElement.dataset.logout === 'true') {
                 document.getElementById('message').innerText = 'You have logged out.';
                 socket.close(); // WebSocket を閉じる
             }
@@ -72,6 +72,44 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    // スニペットを入力中のコマンドとして挿入する (Enter は送らない)
+    const snippetSelect = document.getElementById('snippetSelect');
+    let snippets = [];
+    fetch('/api/snippets')
+        .then(response => response.json())
+        .then(lib => {
+            snippets = lib.snippets;
+            snippets.forEach((s, i) => {
+                const opt = document.createElement('option');
+                opt.value = i;
+                opt.textContent = s.name;
+                snippetSelect.appendChild(opt);
+            });
+        })
+        .catch(err => console.error('Failed to load snippets:', err));
+
+    snippetSelect.addEventListener('change', () => {
+        const snippet = snippets[snippetSelect.value];
+        snippetSelect.value = '';
+        if (!snippet) return;
+        const vars = {};
+        for (const v of snippet.variables) {
+            const value = prompt(`${snippet.name}: ${v}`);
+            if (value === null) return;
+            vars[v] = value;
+        }
+        postJSON('/api/snippets/render', {name: snippet.name, vars: vars})
+            .then(result => {
+                if (socket.readyState === WebSocket.OPEN) {
+                    // ブラケットペーストで送り、改行が含まれていてもシェルに実行させない
+                    const text = result.command.replace(/\x1b\[20[01]~/g, '');
+                    socket.send(`\x1b[200~${text}\x1b[201~`);
+                }
+                term.focus();
+            })
+            .catch(err => term.write(`\r\nSnippet error: ${err.message}\r\n`));
+    });
+
     window.addEventListener('beforeunload', () => {
         socket.close();
     });
@@ -0,0 +1,114 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const trashTable = document.getElementById('trashTable');
+    const selectAll = document.getElementById('selectAll');
+    const selectionInfo = document.getElementById('selectionInfo');
+    const trashStatus = document.getElementById('trashStatus');
+    const restoreBtn = document.getElementById('restoreBtn');
+    const purgeBtn = document.getElementById('purgeBtn');
+
+    // 選択中の項目名 (ゴミ箱内の名前)
+    const selected = new Set();
+
+    loadTrash();
+    document.getElementById('refreshBtn').addEventListener('click', loadTrash);
+
+    selectAll.addEventListener('change', () => {
+        trashTable.querySelectorAll('input[type="checkbox"]').forEach(cb => {
+            cb.checked = selectAll.checked;
+            if (selectAll.checked) selected.add(cb.dataset.name);
+            else selected.delete(cb.dataset.name);
+        });
+        updateSelection();
+    });
+
+    restoreBtn.addEventListener('click', () => {
+        runAction('/api/trash/restore', 'Restored');
+    });
+
+    purgeBtn.addEventListener('click', () => {
+        if (!confirm(`Permanently delete ${selected.size} item(s)? This cannot be undone.`)) return;
+        runAction('/api/trash/purge', 'Deleted');
+    });
+
+    function runAction(url, verb) {
+        const names = Array.from(selected);
+        postJSON(url, {names})
+            .then(results => {
+                const failed = results.filter(r => !r.ok);
+                trashStatus.textContent = failed.length === 0
+                    ? `${verb} ${results.length} item(s)`
+                    : failed.map(r => `${r.path}: ${r.error}`).join(', ');
+                selected.clear();
+                selectAll.checked = false;
+                loadTrash();
+            })
+            .catch(err => trashStatus.textContent = err.message);
+    }
+
+    function updateSelection() {
+        selectionInfo.textContent = selected.size === 0
+            ? 'No items selected'
+            : `${selected.size} selected`;
+        restoreBtn.disabled = selected.size === 0;
+        purgeBtn.disabled = selected.size === 0;
+    }
+
+    function formatBytes(n) {
+        const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+        let i = 0;
+        while (n >= 1024 && i < units.length - 1) {
+            n /= 1024;
+            i++;
+        }
+        return `${i === 0 ? n : n.toFixed(1)} ${units[i]}`;
+    }
+
+    function loadTrash() {
+        fetch('/api/trash')
+            .then(response => response.json())
+            .then(renderTrash)
+            .catch(err => console.error('Failed to load trash:', err));
+    }
+
+    function renderTrash(items) {
+        if (!Array.isArray(items)) {
+            trashTable.innerHTML = `<tr><td colspan="5" class="status-fail"></td></tr>`;
+            trashTable.querySelector('td').textContent = items.error || 'Failed to load trash';
+            return;
+        }
+        const names = new Set(items.map(item => item.name));
+        selected.forEach(name => {
+            if (!names.has(name)) selected.delete(name);
+        });
+
+        trashTable.innerHTML = '';
+        if (items.length === 0) {
+            trashTable.innerHTML = `<tr><td colspan="5" class="muted">The trash is empty.</td></tr>`;
+        }
+        items.forEach(item => {
+            const tr = document.createElement('tr');
+            tr.innerHTML = `
+                <td><input type="checkbox"></td>
+                <td class="mono"></td>
+                <td></td>
+                <td></td>
+                <td></td>
+            `;
+            const cb = tr.querySelector('input');
+            cb.dataset.name = item.name;
+            cb.checked = selected.has(item.name);
+            cb.addEventListener('change', () => {
+                if (cb.checked) selected.add(item.name);
+                else selected.delete(item.name);
+                updateSelection();
+            });
+            const cells = tr.querySelectorAll('td');
+            cells[1].textContent = '/' + item.path;
+            cells[2].textContent = item.type || '-';
+            cells[3].textContent = formatBytes(item.size);
+            cells[4].textContent = item.deleted.replace('T', ' ');
+            trashTable.appendChild(tr);
+        });
+        updateSelection();
+    }
+});
@@ -0,0 +1,130 @@
+// Package systemd builds systemctl commands and parses their output.
+package systemd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Unit is a systemd service unit
+type Unit struct {
+	Name        string `json:"name"`
+	Load        string `json:"load"`
+	Active      string `json:"active"`
+	Sub         string `json:"sub"`
+	Description string `json:"description"`
+	// UnitFileState is enabled, disabled, static, masked, ...
+	UnitFileState string `json:"unit_file_state"`
+}
+
+// Actions lists the operations permitted on a unit
+var Actions = map[string]bool{
+	"start":   true,
+	"stop":    true,
+	"restart": true,
+	"reload":  true,
+	"enable":  true,
+	"disable": true,
+}
+
+var unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:\\-]*$`)
+
+// ValidName reports whether name is a plausible unit name
+func ValidName(name string) bool {
+	return len(name) <= 256 && unitNamePattern.MatchString(name)
+}
+
+// ListUnitsJSONArgs lists service units as JSON (systemd 240+)
+var ListUnitsJSONArgs = []string{"systemctl", "list-units", "--type=service", "--all", "--no-pager", "--output=json"}
+
+// ListUnitsArgs lists service units as plain text for older systemd
+var ListUnitsArgs = []string{"systemctl", "list-units", "--type=service", "--all", "--no-pager", "--no-legend", "--plain"}
+
+// ListUnitFilesArgs lists the enablement state of service unit files
+var ListUnitFilesArgs = []string{"systemctl", "list-unit-files", "--type=service", "--no-pager", "--no-legend"}
+
+// ParseUnitsJSON parses the output of ListUnitsJSONArgs
+func ParseUnitsJSON(out string) ([]Unit, error) {
+	var raw []struct {
+		Unit        string `json:"unit"`
+		Load        string `json:"load"`
+		Active      string `json:"active"`
+		Sub         string `json:"sub"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("unexpected systemctl output: %v", err)
+	}
+	units := make([]Unit, 0, len(raw))
+	for _, u := range raw {
+		units = append(units, Unit{
+			Name:        u.Unit,
+			Load:        u.Load,
+			Active:      u.Active,
+			Sub:         u.Sub,
+			Description: u.Description,
+		})
+	}
+	return units, nil
+}
+
+// ParseUnits parses the output of ListUnitsArgs:
+// UNIT LOAD ACTIVE SUB DESCRIPTION...
+func ParseUnits(out string) []Unit {
+	var units []Unit
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		// 古い systemd では失敗したユニットの先頭に "●" が付く
+		if len(fields) > 0 && (fields[0] == "●" || fields[0] == "*") {
+			fields = fields[1:]
+		}
+		if len(fields) < 4 {
+			continue
+		}
+		units = append(units, Unit{
+			Name:        fields[0],
+			Load:        fields[1],
+			Active:      fields[2],
+			Sub:         fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+	return units
+}
+
+// ParseUnitFiles parses the output of ListUnitFilesArgs into unit name -> state
+func ParseUnitFiles(out string) map[string]string {
+	states := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		states[fields[0]] = fields[1]
+	}
+	return states
+}
+
+// Merge adds unit file states to units and includes unit files that are
+// not loaded (for example disabled services), sorted by name
+func Merge(units []Unit, states map[string]string) []Unit {
+	seen := make(map[string]bool, len(units))
+	for i := range units {
+		units[i].UnitFileState = states[units[i].Name]
+		seen[units[i].Name] = true
+	}
+	for name, state := range states {
+		// テンプレートユニット (foo@.service) は直接操作できない
+		if seen[name] || strings.HasSuffix(name, "@.service") {
+			continue
+		}
+		units = append(units, Unit{Name: name, Load: "not-loaded", Active: "inactive", Sub: "dead", UnitFileState: state})
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].Name < units[j].Name
+	})
+	return units
+}
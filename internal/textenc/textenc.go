@@ -0,0 +1,143 @@
+// Package textenc detects the encoding of text files and converts them
+// to and from UTF-8 for editing in the browser.
+package textenc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Supported encodings
+const (
+	UTF8    = "utf-8"
+	UTF8BOM = "utf-8-bom"
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+	Latin1  = "iso-8859-1"
+)
+
+// ErrBinary is returned for content that does not look like text
+var ErrBinary = errors.New("file looks like binary data")
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Decode detects the encoding of b and returns its content as UTF-8
+func Decode(b []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		if !utf8.Valid(b[3:]) {
+			return "", "", ErrBinary
+		}
+		return string(b[3:]), UTF8BOM, nil
+	case bytes.HasPrefix(b, bomUTF16LE):
+		s, err := decodeUTF16(b[2:], binary.LittleEndian)
+		return s, UTF16LE, err
+	case bytes.HasPrefix(b, bomUTF16BE):
+		s, err := decodeUTF16(b[2:], binary.BigEndian)
+		return s, UTF16BE, err
+	}
+	// NUL を含むものはテキストとして扱わない
+	if bytes.IndexByte(b, 0) >= 0 {
+		return "", "", ErrBinary
+	}
+	if utf8.Valid(b) {
+		return string(b), UTF8, nil
+	}
+	// UTF-8 でなければ 1 バイト 1 文字の Latin-1 とみなす
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes), Latin1, nil
+}
+
+// DetectBOM returns the encoding marked by a byte order mark at the start
+// of b, or "" if there is none
+func DetectBOM(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return UTF8BOM
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return UTF16BE
+	}
+	return ""
+}
+
+// DecodeAs converts b from the given encoding to UTF-8. Unlike Decode it
+// needs no byte order mark, so it also works on a part of a file after
+// the first; a mark at the start of b is skipped.
+func DecodeAs(b []byte, encoding string) (string, error) {
+	switch encoding {
+	case UTF8, UTF8BOM:
+		b = bytes.TrimPrefix(b, bomUTF8)
+		if !utf8.Valid(b) {
+			return "", ErrBinary
+		}
+		return string(b), nil
+	case UTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(b, bomUTF16LE), binary.LittleEndian)
+	case UTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(b, bomUTF16BE), binary.BigEndian)
+	case Latin1:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+	}
+	return "", fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+// Encode converts UTF-8 text back to the given encoding
+func Encode(s, encoding string) ([]byte, error) {
+	switch encoding {
+	case UTF8, "":
+		return []byte(s), nil
+	case UTF8BOM:
+		return append(append([]byte{}, bomUTF8...), s...), nil
+	case UTF16LE:
+		return append(append([]byte{}, bomUTF16LE...), encodeUTF16(s, binary.LittleEndian)...), nil
+	case UTF16BE:
+		return append(append([]byte{}, bomUTF16BE...), encodeUTF16(s, binary.BigEndian)...), nil
+	case Latin1:
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xFF {
+				return nil, fmt.Errorf("character %q cannot be written in %s", r, Latin1)
+			}
+			b = append(b, byte(r))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) (string, error) {
+	if len(b)%2 != 0 {
+		return "", ErrBinary
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, len(units)*2)
+	for i, u := range units {
+		order.PutUint16(b[i*2:], u)
+	}
+	return b
+}
@@ -0,0 +1,126 @@
+// Package thumb makes small JPEG thumbnails of images for the drive grid.
+package thumb
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"path"
+	"strings"
+
+	// デコーダの登録
+	_ "image/gif"
+	_ "image/png"
+)
+
+// Size is the longest edge of a thumbnail in pixels
+const Size = 160
+
+// MaxPixels is the largest source image decoded, to keep memory bounded.
+// A decoded RGBA image of this size takes 64 MiB.
+const MaxPixels = 4096 * 4096
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// 透過画像を合成する背景色 (ドライブ画面の背景に合わせる)
+var background = color.RGBA{R: 0x1c, G: 0x1c, B: 0x1e, A: 0xff}
+
+var extensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// Supported reports whether name has an extension that can be thumbnailed
+func Supported(name string) bool {
+	return extensions[strings.ToLower(path.Ext(name))]
+}
+
+// Generate decodes an image from r and returns a JPEG whose longest edge
+// is at most size pixels. Smaller images are not enlarged.
+func Generate(r io.Reader, size int) ([]byte, error) {
+	// ヘッダだけ先に読んで巨大な画像のデコードを避ける
+	var head bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, image.ErrFormat
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := fit(cfg.Width, cfg.Height, size)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Resize(src, w, h), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit scales w x h down so that the longest edge is at most size
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
+
+// Resize scales src to w x h by averaging the source pixels covered by
+// each destination pixel. Transparent areas are composited on the
+// background colour since JPEG has no alpha channel. The source is read
+// one row at a time so no full-size copy of it is made.
+func Resize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+	bg := image.NewUniform(background)
+	sums := make([]uint64, w*3)
+
+	for dy := 0; dy < h; dy++ {
+		y0 := dy * sh / h
+		y1 := max((dy+1)*sh/h, y0+1)
+		clear(sums)
+		for y := y0; y < y1; y++ {
+			draw.Draw(row, row.Bounds(), bg, image.Point{}, draw.Src)
+			draw.Draw(row, row.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+y), draw.Over)
+			for dx := 0; dx < w; dx++ {
+				x0 := dx * sw / w
+				x1 := max((dx+1)*sw/w, x0+1)
+				for i := x0 * 4; i < x1*4; i += 4 {
+					sums[dx*3] += uint64(row.Pix[i])
+					sums[dx*3+1] += uint64(row.Pix[i+1])
+					sums[dx*3+2] += uint64(row.Pix[i+2])
+				}
+			}
+		}
+		for dx := 0; dx < w; dx++ {
+			x0 := dx * sw / w
+			x1 := max((dx+1)*sw/w, x0+1)
+			n := uint64((x1 - x0) * (y1 - y0))
+			o := dy*dst.Stride + dx*4
+			dst.Pix[o] = uint8(sums[dx*3] / n)
+			dst.Pix[o+1] = uint8(sums[dx*3+1] / n)
+			dst.Pix[o+2] = uint8(sums[dx*3+2] / n)
+			dst.Pix[o+3] = 0xff
+		}
+	}
+	return dst
+}
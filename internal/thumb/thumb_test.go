@@ -0,0 +1,110 @@
+package thumb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, size   int
+		wantW, wantH int
+	}{
+		{100, 50, 160, 100, 50},
+		{1600, 800, 160, 160, 80},
+		{800, 1600, 160, 80, 160},
+		{5000, 10, 160, 160, 1},
+		{160, 160, 160, 160, 160},
+	}
+	for _, tt := range tests {
+		if w, h := fit(tt.w, tt.h, tt.size); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%d, %d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.size, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	// 4x4 の画像を 4 色の 2x2 ブロックに分け、2x2 に縮小する
+	src := image.NewNRGBA(image.Rect(10, 10, 14, 14))
+	colors := []color.NRGBA{
+		{255, 0, 0, 255}, {0, 255, 0, 255},
+		{0, 0, 255, 255}, {0, 0, 0, 0},
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetNRGBA(10+x, 10+y, colors[(y/2)*2+x/2])
+		}
+	}
+	dst := Resize(src, 2, 2)
+	want := []color.RGBA{
+		{255, 0, 0, 255}, {0, 255, 0, 255},
+		{0, 0, 255, 255}, background,
+	}
+	for i, c := range want {
+		if got := dst.RGBAAt(i%2, i/2); got != c {
+			t.Errorf("pixel (%d,%d) = %v, want %v", i%2, i/2, got, c)
+		}
+	}
+
+	// 横方向の平均
+	stripes := image.NewGray(image.Rect(0, 0, 4, 1))
+	copy(stripes.Pix, []byte{0, 100, 200, 40})
+	if got := Resize(stripes, 1, 1).RGBAAt(0, 0); got != (color.RGBA{85, 85, 85, 255}) {
+		t.Errorf("average = %v, want {85 85 85 255}", got)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 640, 320))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Generate(&buf, Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 160 || b.Dy() != 80 {
+		t.Errorf("thumbnail is %dx%d, want 160x80", b.Dx(), b.Dy())
+	}
+}
+
+// 画像のサイズはヘッダだけで判定され、本体はデコードされない
+func TestGenerateTooLarge(t *testing.T) {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], 8192)
+	binary.BigEndian.PutUint32(ihdr[4:], 8192)
+	ihdr[8], ihdr[9] = 8, 6 // 8 bit RGBA
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+
+	if _, err := Generate(&buf, Size); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Generate error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.jpg": true, "b.JPEG": true, "c.png": true, "d.gif": true,
+		"e.webp": false, "f": false, "g.svg": false,
+	} {
+		if got := Supported(name); got != want {
+			t.Errorf("Supported(%q) = %v, want %v", name, got, want)
+		}
+	}
+}